@@ -0,0 +1,163 @@
+package goclip
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Backend is the interface implemented by clipboard systems. Each supported
+// platform registers its native backend, and custom implementations can be
+// registered with RegisterBackend or installed directly with SetBackend.
+type Backend interface {
+	// Copy makes value available on the given board. A value of type Invalid
+	// clears the board.
+	Copy(ctx context.Context, board Board, value Data) error
+	// Paste returns the data currently available on the given board
+	Paste(ctx context.Context, board Board) (Data, error)
+	// Fetch retrieves the data available on board in a given format, usually
+	// a MIME type
+	Fetch(ctx context.Context, board Board, format string) ([]byte, error)
+	// Monitor registers mon so it receives clipboard events
+	Monitor(mon *Monitor) error
+	// Unmonitor removes mon from the registered monitors
+	Unmonitor(mon *Monitor) error
+	// Poll checks if any change happened to the clipboard and notifies mon
+	Poll(mon *Monitor) error
+	// Close releases any resource held by the backend
+	Close() error
+}
+
+// MultiFetcher is implemented by backends able to retrieve multiple formats at
+// once, more efficiently than by calling Fetch for each format.
+type MultiFetcher interface {
+	// FetchMultiple retrieves the data available on board in the given
+	// formats. Formats that are not available are not included in the
+	// result, other errors are returned.
+	FetchMultiple(ctx context.Context, board Board, formats []string) (map[string][]byte, error)
+}
+
+// OptionCopier is implemented by backends supporting copy options, such as
+// being notified when the copied data is replaced.
+type OptionCopier interface {
+	// CopyWithOptions works like Copy, applying the given options
+	CopyWithOptions(ctx context.Context, board Board, value Data, opts *CopyOptions) error
+}
+
+// Owner is implemented by backends able to tell whether the data they copied
+// is still on a board
+type Owner interface {
+	// IsOwner returns true if the data copied to board has not been replaced
+	IsOwner(board Board) bool
+}
+
+// Persister is implemented by backends that need to hand the data they own to
+// a clipboard manager for it to remain available once the program exits.
+type Persister interface {
+	// Persist hands the data owned by the backend to the clipboard manager
+	// and returns once it has been saved
+	Persist(ctx context.Context) error
+}
+
+// Manager is implemented by backends able to act as a clipboard manager
+type Manager interface {
+	// Manage acts as the clipboard manager until ctx is cancelled, keeping
+	// the clipboard content available after its owner exits
+	Manage(ctx context.Context) error
+}
+
+// BackendFactory is a function returning a new instance of a Backend,
+// configured with the given settings
+type BackendFactory func(ctx context.Context, cfg *Config) (Backend, error)
+
+var (
+	backends     = make(map[string]BackendFactory)
+	backendNames []string
+	backendLk    sync.Mutex
+
+	std   *Clipboard
+	stdLk sync.Mutex
+)
+
+// RegisterBackend makes a backend available under the given name. The first
+// registered backend (typically the platform's native one) is used by default.
+// RegisterBackend panics if called twice with the same name.
+func RegisterBackend(name string, f BackendFactory) {
+	backendLk.Lock()
+	defer backendLk.Unlock()
+
+	if f == nil {
+		panic("goclip: RegisterBackend factory is nil")
+	}
+	if _, dup := backends[name]; dup {
+		panic("goclip: RegisterBackend called twice for backend " + name)
+	}
+	backends[name] = f
+	backendNames = append(backendNames, name)
+}
+
+// Backends returns the names of the registered backends, in order of
+// registration
+func Backends() []string {
+	backendLk.Lock()
+	defer backendLk.Unlock()
+
+	return append([]string(nil), backendNames...)
+}
+
+// lookupBackend returns the factory for the backend registered under name, or
+// the default backend if name is empty
+func lookupBackend(name string) (BackendFactory, error) {
+	backendLk.Lock()
+	defer backendLk.Unlock()
+
+	if name == "" {
+		if len(backendNames) == 0 {
+			return nil, ErrNoSys
+		}
+		name = backendNames[0]
+	}
+	f, ok := backends[name]
+	if !ok {
+		return nil, fmt.Errorf("goclip: unknown backend %q", name)
+	}
+	return f, nil
+}
+
+// SetBackend sets the backend used by the package level functions. The
+// previous backend is not closed.
+func SetBackend(b Backend) {
+	stdLk.Lock()
+	defer stdLk.Unlock()
+
+	std = NewClipboard(b)
+}
+
+// UseBackend instantiates the backend registered under the given name and
+// sets it as the backend used by the package level functions.
+func UseBackend(name string) error {
+	c, err := Open(context.Background(), WithBackend(name))
+	if err != nil {
+		return err
+	}
+	SetBackend(c.b)
+	return nil
+}
+
+// getDefault returns the clipboard used by the package level functions,
+// opening it with the default backend if needed
+func getDefault() (*Clipboard, error) {
+	stdLk.Lock()
+	defer stdLk.Unlock()
+
+	if std != nil {
+		return std, nil
+	}
+
+	c, err := Open(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	std = c
+	return c, nil
+}
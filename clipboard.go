@@ -0,0 +1,243 @@
+package goclip
+
+import (
+	"context"
+	"errors"
+)
+
+// Clipboard is a handle on a clipboard system, as returned by Open. Multiple
+// clipboards can be opened at the same time, for example to connect to
+// different displays. The package level functions use a default clipboard.
+type Clipboard struct {
+	b Backend
+}
+
+// Config holds the settings used to open a clipboard. It is passed to the
+// backend factory, which may ignore settings that do not apply to it.
+type Config struct {
+	// Backend is the name of the backend to use, or empty for the default one
+	Backend string
+	// Display is the name of the display to connect to (X11 only), such as
+	// ":1". If empty, the DISPLAY environment variable is used.
+	Display string
+	// Screen is the screen number to use (X11 only), or -1 for the display's
+	// default screen
+	Screen int
+}
+
+// Option is an option that can be passed to Open
+type Option func(*Config)
+
+// WithBackend selects the backend registered under the given name
+func WithBackend(name string) Option {
+	return func(cfg *Config) {
+		cfg.Backend = name
+	}
+}
+
+// WithDisplay sets the name of the display to connect to
+func WithDisplay(name string) Option {
+	return func(cfg *Config) {
+		cfg.Display = name
+	}
+}
+
+// WithScreen sets the screen number to use on the display
+func WithScreen(screen int) Option {
+	return func(cfg *Config) {
+		cfg.Screen = screen
+	}
+}
+
+// Open opens a new clipboard using the given options. The clipboard should be
+// closed with Close when not needed anymore.
+func Open(ctx context.Context, opts ...Option) (*Clipboard, error) {
+	cfg := &Config{Screen: -1}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	f, err := lookupBackend(cfg.Backend)
+	if err != nil {
+		return nil, opError("open", InvalidBoard, "", err)
+	}
+	b, err := f(ctx, cfg)
+	if err != nil {
+		return nil, opError("open", InvalidBoard, "", err)
+	}
+	return NewClipboard(b), nil
+}
+
+// NewClipboard returns a clipboard using the given backend
+func NewClipboard(b Backend) *Clipboard {
+	return &Clipboard{b: b}
+}
+
+// Backend returns the backend used by the clipboard
+func (c *Clipboard) Backend() Backend {
+	return c.b
+}
+
+// Copy copies the given values to the default board
+func (c *Clipboard) Copy(ctx context.Context, values ...interface{}) error {
+	return c.CopyTo(ctx, Default, values...)
+}
+
+// CopyTo copies the given values to the specified board. Values may include
+// CopyOption values such as OnLost, in which case ErrNoSys is returned if the
+// backend does not support them.
+func (c *Clipboard) CopyTo(ctx context.Context, board Board, values ...interface{}) error {
+	return opError("copy", board, "", c.copyTo(ctx, board, values))
+}
+
+func (c *Clipboard) copyTo(ctx context.Context, board Board, values []interface{}) error {
+	values, opts := splitCopyOptions(values)
+	value, err := spawnValue(values...)
+	if err != nil {
+		return err
+	}
+	if opts == nil {
+		return c.b.Copy(ctx, board, value)
+	}
+	if oc, ok := c.b.(OptionCopier); ok {
+		return oc.CopyWithOptions(ctx, board, value, opts)
+	}
+	return ErrNoSys
+}
+
+// CopyQueue copies a list of values to board, which are served one after
+// another: each paste moves on to the next item, and the board is cleared once
+// the last item was pasted. This allows pasting multiple values in sequence,
+// for example to fill a form. Items can be any value accepted by CopyTo, and
+// CopyOption values apply to the whole queue. Setting MaxServes allows each
+// item to be pasted multiple times.
+func (c *Clipboard) CopyQueue(ctx context.Context, board Board, items ...interface{}) error {
+	return opError("copy", board, "", c.copyQueue(ctx, board, items))
+}
+
+func (c *Clipboard) copyQueue(ctx context.Context, board Board, items []interface{}) error {
+	items, opts := splitCopyOptions(items)
+	if len(items) == 0 {
+		return ErrNoData
+	}
+	if opts == nil {
+		opts = &CopyOptions{}
+	}
+	if opts.MaxServes <= 0 {
+		opts.MaxServes = 1
+	}
+
+	queue := make([]Data, 0, len(items))
+	for _, item := range items {
+		value, err := spawnValue(item)
+		if err != nil {
+			return err
+		}
+		queue = append(queue, value)
+	}
+	opts.Queue = queue[1:]
+
+	oc, ok := c.b.(OptionCopier)
+	if !ok {
+		return ErrNoSys
+	}
+	return oc.CopyWithOptions(ctx, board, queue[0], opts)
+}
+
+// IsOwner returns true if the data last copied to board through this
+// clipboard is still there. It returns false if another application copied
+// something since, or if the backend cannot tell.
+func (c *Clipboard) IsOwner(board Board) bool {
+	if o, ok := c.b.(Owner); ok {
+		return o.IsOwner(board)
+	}
+	return false
+}
+
+// Paste retrieves data from the default board
+func (c *Clipboard) Paste(ctx context.Context) (Data, error) {
+	return c.PasteFrom(ctx, Default)
+}
+
+// PasteFrom retrieves data from the specified board
+func (c *Clipboard) PasteFrom(ctx context.Context, from Board) (Data, error) {
+	data, err := c.b.Paste(ctx, from)
+	if err != nil {
+		return nil, opError("paste", from, "", err)
+	}
+	return data, nil
+}
+
+// FetchFormats retrieves the data available on board in the given formats.
+// Formats that are not available are not included in the result, while other
+// errors, such as ErrNoData if the board is empty, are returned.
+func (c *Clipboard) FetchFormats(ctx context.Context, board Board, formats ...string) (map[string][]byte, error) {
+	if mf, ok := c.b.(MultiFetcher); ok {
+		res, err := mf.FetchMultiple(ctx, board, formats)
+		if err != nil {
+			return nil, opError("fetch", board, "", err)
+		}
+		return res, nil
+	}
+
+	res := make(map[string][]byte)
+	for _, f := range formats {
+		v, err := c.b.Fetch(ctx, board, f)
+		if errors.Is(err, ErrFormatUnavailable) {
+			continue
+		}
+		if err != nil {
+			return nil, opError("fetch", board, f, err)
+		}
+		res[f] = v
+	}
+	return res, nil
+}
+
+// NewMonitor returns a new monitor receiving events from this clipboard
+func (c *Clipboard) NewMonitor() (*Monitor, error) {
+	mon := &Monitor{b: c.b}
+	err := c.b.Monitor(mon)
+	if err != nil {
+		return nil, err
+	}
+	return mon, nil
+}
+
+// Persist ensures that data copied to the clipboard remains available after
+// the program exits. On X11 the data is handed to the clipboard manager, and
+// ErrNoManager is returned if there is none. Other systems keep clipboard data
+// on their own, and Persist does nothing.
+func (c *Clipboard) Persist(ctx context.Context) error {
+	if p, ok := c.b.(Persister); ok {
+		return opError("persist", Default, "", p.Persist(ctx))
+	}
+	return nil
+}
+
+// Manage makes the clipboard act as a clipboard manager until ctx is
+// cancelled: the content of the clipboard is saved each time it changes and
+// is served again after the application that copied it exits. This is only
+// needed on X11 systems that do not run a clipboard manager, other systems
+// return ErrNoSys.
+func (c *Clipboard) Manage(ctx context.Context) error {
+	if m, ok := c.b.(Manager); ok {
+		return opError("manage", Default, "", m.Manage(ctx))
+	}
+	return opError("manage", Default, "", ErrNoSys)
+}
+
+// Close persists the data copied to the clipboard if possible, then releases
+// the resources held by the clipboard, such as the connection to the X server.
+// Operations on a closed X11 clipboard return ErrClosed.
+func (c *Clipboard) Close(ctx context.Context) error {
+	err := c.Persist(ctx)
+	if errors.Is(err, ErrNoManager) {
+		// nothing more can be done
+		err = nil
+	}
+	if cerr := c.b.Close(); cerr != nil {
+		return cerr
+	}
+	return err
+}
@@ -0,0 +1,230 @@
+package goclip
+
+/*
+#include <stdlib.h>
+#include <xcb/xcb.h>
+*/
+import "C"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// abandonedTimeout is how long a cancelled request waits for the answer of the
+// owner before being dropped, as owners that hung or exited never answer
+const abandonedTimeout = time.Minute
+
+// pendingRequest is a conversion we requested from the owner of a selection,
+// waiting for its answer. Each request uses its own property so concurrent
+// requests do not receive each other's data.
+type pendingRequest struct {
+	selection C.xcb_atom_t
+	target    C.xcb_atom_t
+	property  C.xcb_atom_t
+	time      C.xcb_timestamp_t
+	seq       C.uint // sequence number of the request
+	ch        chan evData
+	abandoned time.Time // when the request was cancelled, zero if it was not
+}
+
+// allocProperty returns a property of our window that is not used by any
+// pending request
+func (i *internal) allocProperty() C.xcb_atom_t {
+	i.pendingL.Lock()
+	if n := len(i.freeProps); n > 0 {
+		prop := i.freeProps[n-1]
+		i.freeProps = i.freeProps[:n-1]
+		i.pendingL.Unlock()
+		return prop
+	}
+	i.propSeq++
+	name := fmt.Sprintf("GOCLIP_PROP_%d", i.propSeq)
+	i.pendingL.Unlock()
+
+	return i.atom(name)
+}
+
+// freeProperty makes a property available for other requests once its value
+// has been read
+func (i *internal) freeProperty(prop C.xcb_atom_t) {
+	i.pendingL.Lock()
+	defer i.pendingL.Unlock()
+
+	i.freeProps = append(i.freeProps, prop)
+}
+
+// convertSelection asks the owner of selection to convert it to target into
+// prop, and waits for its answer. It returns the property holding the result,
+// or None if the conversion was refused, in which case prop can be freed. If
+// ctx is done first, prop is freed once the answer arrives.
+func (i *internal) convertSelection(ctx context.Context, selection, target, prop C.xcb_atom_t) (C.xcb_atom_t, error) {
+	t, err := i.serverTime(ctx)
+	if err != nil {
+		i.freeProperty(prop)
+		return C.XCB_ATOM_NONE, err
+	}
+
+	req := &pendingRequest{
+		selection: selection,
+		target:    target,
+		property:  prop,
+		time:      t,
+		ch:        make(chan evData, 1),
+	}
+
+	// the request is sent with the lock held so an error cannot be reported
+	// before its sequence number is known
+	i.pendingL.Lock()
+	i.expireAbandoned()
+	i.reqSeq++
+	id := i.reqSeq
+	req.seq = C.xcb_convert_selection(i.dpy, i.win, selection, target, prop, t).sequence
+	i.pending[id] = req
+	i.pendingL.Unlock()
+	C.xcb_flush(i.dpy)
+
+	select {
+	case ev := <-req.ch:
+		if ev.err != nil && !errors.Is(ev.err, ErrDisconnected) {
+			i.freeProperty(prop)
+		}
+		return ev.property, ev.err
+	case <-i.done:
+		return C.XCB_ATOM_NONE, ErrClosed
+	case <-i.lostCh():
+		return C.XCB_ATOM_NONE, ErrDisconnected
+	case <-ctx.Done():
+	}
+
+	i.pendingL.Lock()
+	if _, ok := i.pending[id]; ok {
+		// the event loop will clean up when the answer arrives
+		req.abandoned = time.Now()
+		i.pendingL.Unlock()
+		return C.XCB_ATOM_NONE, ctx.Err()
+	}
+	i.pendingL.Unlock()
+
+	// the answer arrived in the meantime, or the connection was lost
+	switch ev := <-req.ch; {
+	case errors.Is(ev.err, ErrDisconnected):
+		// properties are not reused on the new connection
+	case ev.err == nil && ev.property != C.XCB_ATOM_NONE:
+		i.discard(ev.property)
+	default:
+		i.freeProperty(prop)
+	}
+	return C.XCB_ATOM_NONE, ctx.Err()
+}
+
+// completeRequest passes the answer of a selection owner to the matching
+// pending request, and returns false if there is none
+func (i *internal) completeRequest(sEv *C.xcb_selection_notify_event_t) bool {
+	i.pendingL.Lock()
+	var id uint64
+	var req *pendingRequest
+	for k, r := range i.pending {
+		if r.selection != sEv.selection || r.target != sEv.target {
+			continue
+		}
+		if sEv.property == C.XCB_ATOM_NONE {
+			// refusals do not tell which property was used, rely on the
+			// time of the request
+			if sEv.time != r.time && sEv.time != C.XCB_CURRENT_TIME {
+				continue
+			}
+		} else if sEv.property != r.property {
+			continue
+		}
+		if req == nil || preferRequest(k, r, id, req) {
+			id, req = k, r
+		}
+	}
+	if req == nil {
+		i.pendingL.Unlock()
+		return false
+	}
+	delete(i.pending, id)
+	abandoned := !req.abandoned.IsZero()
+	i.pendingL.Unlock()
+
+	if !abandoned {
+		req.ch <- evData{selection: sEv.selection, target: sEv.target, property: sEv.property}
+		return true
+	}
+	if sEv.property != C.XCB_ATOM_NONE {
+		i.discard(sEv.property)
+	} else {
+		i.freeProperty(req.property)
+	}
+	return true
+}
+
+// preferRequest returns true if request r with id k should receive an answer
+// that could also be for request req with id id. Live requests come first, as
+// an answer matched by time only may be for a request that was cancelled, then
+// the oldest request.
+func preferRequest(k uint64, r *pendingRequest, id uint64, req *pendingRequest) bool {
+	if r.abandoned.IsZero() != req.abandoned.IsZero() {
+		return r.abandoned.IsZero()
+	}
+	return k < id
+}
+
+// expireAbandoned drops cancelled requests that were never answered. Their
+// property is not reused, as the owner may still write to it. It must be
+// called with pendingL held.
+func (i *internal) expireAbandoned() {
+	for k, r := range i.pending {
+		if !r.abandoned.IsZero() && time.Since(r.abandoned) > abandonedTimeout {
+			delete(i.pending, k)
+		}
+	}
+}
+
+// failRequest passes an error reported by the X server to the pending request
+// that caused it, and returns false if there is none
+func (i *internal) failRequest(generr *C.xcb_generic_error_t) bool {
+	i.pendingL.Lock()
+	var id uint64
+	var req *pendingRequest
+	for k, r := range i.pending {
+		if uint32(r.seq) == uint32(generr.full_sequence) {
+			id, req = k, r
+			break
+		}
+	}
+	if req == nil {
+		i.pendingL.Unlock()
+		return false
+	}
+	delete(i.pending, id)
+	abandoned := !req.abandoned.IsZero()
+	i.pendingL.Unlock()
+
+	if abandoned {
+		i.freeProperty(req.property)
+		return true
+	}
+	req.ch <- evData{selection: req.selection, target: req.target, err: &Error{
+		Err:   ErrProtocol,
+		Code:  uint8(generr.error_code),
+		Major: uint8(generr.major_code),
+		Minor: uint16(generr.minor_code),
+	}}
+	return true
+}
+
+// discard deletes the result of a conversion nobody waits for anymore, and
+// frees its property unless the owner started an INCR transfer into it, in
+// which case chunks may still be written to it
+func (i *internal) discard(prop C.xcb_atom_t) {
+	_, typ, err := i.readProperty(i.win, prop, true)
+	if err != nil || typ == i.atom("INCR") {
+		return
+	}
+	i.freeProperty(prop)
+}
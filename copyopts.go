@@ -0,0 +1,120 @@
+package goclip
+
+import "time"
+
+// CopyOption is an option that can be passed to Copy and CopyTo among the
+// values to copy
+type CopyOption func(*CopyOptions)
+
+// CopyOptions holds the settings of a copy, as set by CopyOption values. It is
+// passed to backends implementing OptionCopier.
+type CopyOptions struct {
+	// OnLost is called once the copied data is not on the board anymore,
+	// because another copy replaced it or the board was cleared
+	OnLost func()
+	// TTL is the duration after which the board is cleared, if the copied
+	// data is still on it
+	TTL time.Duration
+	// MaxServes is the number of times the data can be pasted before the
+	// board is cleared, or 0 for no limit
+	MaxServes int
+	// Wait makes the copy return only once the data is not on the board
+	// anymore, or the context is done
+	Wait bool
+	// Queue holds data served after the copied value, each item replacing
+	// the previous one once it was pasted MaxServes times. It is set by
+	// CopyQueue.
+	Queue []Data
+	// OnRequest is called for each request of the data by another
+	// application
+	OnRequest RequestHandler
+}
+
+// Request describes a request from another application for data we copied
+type Request struct {
+	// Board is the board the data was requested from
+	Board Board
+	// Format is the requested format, a MIME type or a system specific name
+	// such as UTF8_STRING. It is empty if all formats are requested at once.
+	Format string
+	// Data is the copied data
+	Data Data
+	// Requestor is the window of the requesting application (X11 only)
+	Requestor uint32
+	// Class is the WM_CLASS of the requestor window, if known (X11 only)
+	Class string
+	// PID is the process id of the requestor, or 0 if unknown
+	PID int
+	// Time is when the request was received
+	Time time.Time
+}
+
+// RequestHandler decides how a request for copied data is answered. It returns
+// the data to serve, which is usually req.Data, or nil to deny the request.
+type RequestHandler func(req *Request) Data
+
+// OnLost sets a function to be called once the copied data is not on the
+// board anymore, typically because another application copied something.
+func OnLost(f func()) CopyOption {
+	return func(o *CopyOptions) {
+		o.OnLost = f
+	}
+}
+
+// ExpireAfter clears the board once d has elapsed, unless another application
+// copied something in the meantime. Once the data is not on the board anymore,
+// backends that hold it overwrite it with zeroes if it is a StaticData, as
+// returned by SpawnText.
+func ExpireAfter(d time.Duration) CopyOption {
+	return func(o *CopyOptions) {
+		o.TTL = d
+	}
+}
+
+// MaxServes clears the board once the data has been pasted n times. Requests
+// that only list the available formats are not counted. Backends that hold the
+// data overwrite it with zeroes once cleared if it is a StaticData.
+func MaxServes(n int) CopyOption {
+	return func(o *CopyOptions) {
+		o.MaxServes = n
+	}
+}
+
+// Wait makes Copy block until the copied data is not on the board anymore, for
+// example because it was pasted the number of times set by MaxServes. If ctx is
+// done first, its error is returned and the data stays on the board.
+func Wait() CopyOption {
+	return func(o *CopyOptions) {
+		o.Wait = true
+	}
+}
+
+// OnRequest sets a function called each time another application requests the
+// copied data, which can be used to audit, deny or alter what is served.
+// Requests that only list the available formats are not passed to it. On X11
+// the handler runs in the event loop and must return quickly.
+func OnRequest(h RequestHandler) CopyOption {
+	return func(o *CopyOptions) {
+		o.OnRequest = h
+	}
+}
+
+// splitCopyOptions separates the CopyOption values from the values to copy,
+// and returns nil options if there was none
+func splitCopyOptions(values []interface{}) ([]interface{}, *CopyOptions) {
+	var opts *CopyOptions
+	res := make([]interface{}, 0, len(values))
+
+	for _, v := range values {
+		opt, ok := v.(CopyOption)
+		if !ok {
+			res = append(res, v)
+			continue
+		}
+		if opts == nil {
+			opts = &CopyOptions{}
+		}
+		opt(opts)
+	}
+	return res, opts
+}
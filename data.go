@@ -23,6 +23,9 @@ type Data interface {
 	ToImage(ctx context.Context) (image.Image, error)
 	// FileList returns a list of files if the clipboard contains file references
 	FileList() ([]string, error)
+	// FileRefs returns the file references found in the clipboard, including
+	// non-local URIs and the operation requested on the files
+	FileRefs(ctx context.Context) (*FileRefList, error)
 
 	// direct format accessors using MIME formats
 	// HasFormat checks if data in a specific MIME format exists
@@ -46,7 +49,21 @@ func (s *StaticDataOption) Type() Type {
 	return simpleTypeFromMime(s.StaticType)
 }
 
+// mimeTypes lists the MIME types whose Type cannot be guessed from their prefix
+var mimeTypes = map[string]Type{
+	"text/uri-list":                FileList,
+	"x-special/gnome-copied-files": FileList,
+}
+
 func simpleTypeFromMime(mime string) Type {
+	base := mime
+	if ppos := strings.IndexByte(base, ';'); ppos != -1 {
+		base = base[:ppos]
+	}
+	if t, ok := mimeTypes[base]; ok {
+		return t
+	}
+
 	// very simplistic but should work in most cases
 	ppos := strings.IndexByte(mime, '/')
 	if ppos == -1 {
@@ -150,35 +167,19 @@ func (s *StaticData) ToImage(ctx context.Context) (image.Image, error) {
 }
 
 func (s *StaticData) FileList() ([]string, error) {
-	// Look for file list format in options
-	for _, opt := range s.Options {
-		if mime := opt.Mime(); strings.HasPrefix(mime, "text/uri-list") {
-			data, err := opt.Data(context.Background())
-			if err != nil {
-				return nil, err
-			}
-
-			// Parse URI list - one URI per line
-			files := []string{}
-			for _, line := range strings.Split(string(data), "\n") {
-				line = strings.TrimSpace(line)
-				if line == "" || strings.HasPrefix(line, "#") {
-					continue // Skip empty lines and comments
-				}
-				// Convert URI to file path - basic implementation
-				if strings.HasPrefix(line, "file://") {
-					path := line[7:]
-					files = append(files, path)
-				}
-			}
-
-			if len(files) > 0 {
-				return files, nil
-			}
-		}
+	refs, err := s.FileRefs(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	files := refs.Paths()
+	if len(files) == 0 {
+		return nil, os.ErrNotExist
 	}
+	return files, nil
+}
 
-	return nil, os.ErrNotExist
+func (s *StaticData) FileRefs(ctx context.Context) (*FileRefList, error) {
+	return fileRefsFromData(ctx, s)
 }
 
 func (s *StaticData) HasFormat(fmt string) bool {
@@ -205,9 +206,21 @@ func (s *StaticData) GetFormat(ctx context.Context, fmt string) ([]byte, error)
 			}
 		}
 	}
-	return nil, os.ErrNotExist
+	return nil, &Error{Op: "fetch", Board: s.TargetBoard, Format: fmt, Err: ErrFormatUnavailable}
 }
 
 func (s *StaticData) GetAllFormats() ([]DataOption, error) {
 	return s.Options, nil
 }
+
+// Scrub overwrites the bytes held by StaticDataOption options with zeroes and
+// removes all options, so sensitive data does not linger in memory.
+func (s *StaticData) Scrub() {
+	for _, o := range s.Options {
+		if so, ok := o.(*StaticDataOption); ok {
+			clear(so.StaticData)
+			so.StaticData = nil
+		}
+	}
+	s.Options = nil
+}
@@ -16,6 +16,8 @@ func (a atom) Mime() string {
 	return a.name
 }
 
+// Data fetches the data in this format. The atom is looked up again by name,
+// as the data may be used after reconnecting to the X server.
 func (a atom) Data(ctx context.Context) ([]byte, error) {
-	return i.fetch(ctx, a.board, a.value)
+	return a.i.Fetch(ctx, a.board, a.name)
 }
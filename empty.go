@@ -34,8 +34,12 @@ func (e emptyData) FileList() ([]string, error) {
 	return nil, nil
 }
 
+func (e emptyData) FileRefs(ctx context.Context) (*FileRefList, error) {
+	return &FileRefList{}, nil
+}
+
 func (e emptyData) GetFormat(ctx context.Context, f string) ([]byte, error) {
-	return nil, os.ErrNotExist
+	return nil, &Error{Op: "fetch", Board: Default, Format: f, Err: ErrFormatUnavailable}
 }
 
 func (e emptyData) HasFormat(f string) bool {
@@ -1,14 +1,89 @@
 package goclip
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
 var (
 	ErrFormatUnavailable = errors.New("goclip: requested format was not available")
 	ErrNoSys             = errors.New("goclip: no system is available")
 	ErrNoBoard           = errors.New("goclip: requested board is not available")
 	ErrNoData            = errors.New("goclip: no data available in clipboard")
+	ErrClosed            = errors.New("goclip: clipboard is closed")
+	ErrDisconnected      = errors.New("goclip: connection to the display was lost")
+	ErrNoManager         = errors.New("goclip: no clipboard manager is available")
+	ErrManagerRunning    = errors.New("goclip: another clipboard manager is running")
+	ErrNotOwner          = errors.New("goclip: could not acquire ownership of the board")
+	ErrProtocol          = errors.New("goclip: request failed on the display server")
 	ErrDataNotString     = errors.New("goclip: requested data is not a String")
 	ErrDataNotImage      = errors.New("goclip: requested data is not an Image")
 	ErrDataNotFileList   = errors.New("goclip: requested data is not an FileList")
 	ErrTiffImageDecode   = errors.New("goclip: cannot decode TIFF format image")
+
+	// errors returned when the system is not available, which all match
+	// ErrNoSys with errors.Is
+	ErrNoDisplay   = fmt.Errorf("%w: no display is set", ErrNoSys)
+	ErrConnRefused = fmt.Errorf("%w: cannot connect to the display", ErrNoSys)
+	ErrNoXFixes    = fmt.Errorf("%w: the XFIXES extension is not available", ErrNoSys)
 )
+
+// Error is the error returned by clipboard operations. It wraps the cause of
+// the failure, such as ErrFormatUnavailable or ErrDisconnected, which can be
+// checked with errors.Is, while errors.As gives access to the details.
+type Error struct {
+	Op     string // operation that failed, such as "paste" or "fetch"
+	Board  Board  // board the operation applied to, if any
+	Format string // requested format, if any
+	Err    error  // cause of the failure
+
+	// details of the X11 protocol error for ErrProtocol
+	Code  uint8  // error code
+	Major uint8  // major opcode of the failed request
+	Minor uint16 // minor opcode of the failed request
+}
+
+func (e *Error) Error() string {
+	msg := "goclip: " + e.Op
+	if e.Format != "" {
+		msg += " " + e.Format
+	}
+	if e.Board != InvalidBoard {
+		msg += " on " + e.Board.String()
+	}
+	if e.Err != nil {
+		msg += ": " + strings.TrimPrefix(e.Err.Error(), "goclip: ")
+	}
+	if e.Code != 0 {
+		msg += fmt.Sprintf(" (X11 error %d, request %d:%d)", e.Code, e.Major, e.Minor)
+	}
+	return msg
+}
+
+// Unwrap returns the cause of the error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// opError returns err as an *Error for the given operation. If err already
+// holds an *Error, the missing details are filled in.
+func opError(op string, board Board, format string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		if e.Op == "" {
+			e.Op = op
+		}
+		if e.Board == InvalidBoard {
+			e.Board = board
+		}
+		if e.Format == "" {
+			e.Format = format
+		}
+		return err
+	}
+	return &Error{Op: op, Board: board, Format: format, Err: err}
+}
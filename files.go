@@ -0,0 +1,257 @@
+package goclip
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// FileOperation is the operation requested on a list of files, when pasted in
+// a file manager
+type FileOperation int
+
+const (
+	// FileCopy means the files are to be copied
+	FileCopy FileOperation = iota
+	// FileMove means the files are to be moved, as a result of a cut
+	FileMove
+)
+
+// String returns the name of the operation as used in the
+// x-special/gnome-copied-files format
+func (op FileOperation) String() string {
+	switch op {
+	case FileMove:
+		return "cut"
+	default:
+		return "copy"
+	}
+}
+
+// Files returns a Data object holding a list of files, offered to other
+// applications as text/uri-list, x-special/gnome-copied-files and plain text.
+// Relative paths are made absolute.
+func Files(paths ...string) Data {
+	return FilesWithOperation(FileCopy, paths...)
+}
+
+// FilesWithOperation returns a Data object holding a list of files similar to
+// Files, with the given operation to be performed when files are pasted.
+func FilesWithOperation(op FileOperation, paths ...string) Data {
+	return &StaticData{Options: fileListOptions(op, paths)}
+}
+
+func fileListOptions(op FileOperation, paths []string) []DataOption {
+	var uris, files []string
+	for _, p := range paths {
+		if abs, err := filepath.Abs(p); err == nil {
+			p = abs
+		}
+		files = append(files, p)
+		uris = append(uris, fileURI(p))
+	}
+
+	res := []DataOption{
+		&StaticDataOption{
+			StaticType: "text/uri-list",
+			StaticData: []byte(strings.Join(uris, "\r\n") + "\r\n"),
+		},
+		&StaticDataOption{
+			StaticType: "x-special/gnome-copied-files",
+			StaticData: []byte(op.String() + "\n" + strings.Join(uris, "\n")),
+		},
+		&StaticDataOption{
+			StaticType: "text/plain;charset=utf-8",
+			StaticData: []byte(strings.Join(files, "\n")),
+		},
+	}
+	if op == FileMove {
+		// KDE uses a separate target to flag cut files
+		res = append(res, &StaticDataOption{StaticType: "application/x-kde-cutselection", StaticData: []byte("1")})
+	}
+	return res
+}
+
+// fileURI returns the percent-encoded file:// URI for a given absolute path
+func fileURI(p string) string {
+	p = filepath.ToSlash(p)
+	if !strings.HasPrefix(p, "/") {
+		// windows paths such as C:/foo
+		p = "/" + p
+	}
+	u := &url.URL{Scheme: "file", Path: p}
+	return u.String()
+}
+
+// FileRef is a reference to a file found in the clipboard
+type FileRef struct {
+	// URI is the URI of the file as found in the clipboard
+	URI *url.URL
+	// Path is the local path of the file, or empty if the URI does not
+	// point to a local file (such as smb:// or sftp:// URIs)
+	Path string
+}
+
+// FileRefList is a list of file references found in the clipboard
+type FileRefList struct {
+	// Refs lists the files, in the order they were found
+	Refs []FileRef
+	// Operation is the operation requested by the source application
+	Operation FileOperation
+}
+
+// Paths returns the local paths of the files in the list, skipping any file
+// that is not local
+func (l *FileRefList) Paths() []string {
+	var res []string
+	for _, ref := range l.Refs {
+		if ref.Path != "" {
+			res = append(res, ref.Path)
+		}
+	}
+	return res
+}
+
+// fileRefsFromData extracts file references from any of the file list formats
+// found in the given Data
+func fileRefsFromData(ctx context.Context, d Data) (*FileRefList, error) {
+	opts, err := d.GetAllFormats()
+	if err != nil {
+		return nil, err
+	}
+
+	// gnome & mate formats also carry the requested operation, use them first
+	for _, mime := range []string{"x-special/gnome-copied-files", "x-special/mate-copied-files"} {
+		opt := findOption(opts, mime)
+		if opt == nil {
+			continue
+		}
+		buf, err := opt.Data(ctx)
+		if err != nil {
+			continue
+		}
+		return parseCopiedFiles(buf), nil
+	}
+
+	opt := findOption(opts, "text/uri-list")
+	if opt == nil {
+		return nil, os.ErrNotExist
+	}
+	buf, err := opt.Data(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := &FileRefList{Refs: parseURIList(buf)}
+
+	// KDE sets a separate target when files are cut
+	if opt := findOption(opts, "application/x-kde-cutselection"); opt != nil {
+		if buf, err := opt.Data(ctx); err == nil && len(buf) > 0 && buf[0] == '1' {
+			res.Operation = FileMove
+		}
+	}
+	return res, nil
+}
+
+// findOption returns the option matching the given MIME type, ignoring any
+// parameter such as charset
+func findOption(opts []DataOption, mime string) DataOption {
+	for _, opt := range opts {
+		m := opt.Mime()
+		if ppos := strings.IndexByte(m, ';'); ppos != -1 {
+			m = m[:ppos]
+		}
+		if m == mime {
+			return opt
+		}
+	}
+	return nil
+}
+
+// parseCopiedFiles parses the x-special/gnome-copied-files format, which is
+// made of the operation ("copy" or "cut") followed by one URI per line
+func parseCopiedFiles(buf []byte) *FileRefList {
+	res := &FileRefList{}
+	lines := splitLines(buf)
+	if len(lines) > 0 {
+		if lines[0] == FileMove.String() {
+			res.Operation = FileMove
+		}
+		lines = lines[1:]
+	}
+	res.Refs = parseURIs(lines)
+	return res
+}
+
+// parseURIList parses the text/uri-list format (RFC 2483)
+func parseURIList(buf []byte) []FileRef {
+	return parseURIs(splitLines(buf))
+}
+
+func splitLines(buf []byte) []string {
+	var res []string
+	for _, line := range strings.Split(string(buf), "\n") {
+		line = strings.TrimRight(line, "\r\x00")
+		if line == "" {
+			continue
+		}
+		res = append(res, line)
+	}
+	return res
+}
+
+func parseURIs(lines []string) []FileRef {
+	var res []FileRef
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue // Skip empty lines and comments
+		}
+		u, err := url.Parse(line)
+		if err != nil || u.Scheme == "" {
+			continue
+		}
+		ref := FileRef{URI: u}
+		if strings.EqualFold(u.Scheme, "file") {
+			ref.Path = fileURIPath(u)
+		}
+		res = append(res, ref)
+	}
+	return res
+}
+
+// fileURIPath returns the local path for a file URI as defined in RFC 8089,
+// or an empty string if the file is located on another host
+func fileURIPath(u *url.URL) string {
+	p := u.Path // already percent-decoded
+	if u.Opaque != "" {
+		// file:path, not valid but sometimes found
+		if v, err := url.PathUnescape(u.Opaque); err == nil {
+			p = v
+		}
+	}
+
+	if !isLocalHost(u.Host) {
+		if runtime.GOOS == "windows" {
+			// can be accessed as an UNC path
+			return filepath.FromSlash("//" + u.Host + p)
+		}
+		return ""
+	}
+
+	if runtime.GOOS == "windows" && len(p) >= 3 && p[0] == '/' && p[2] == ':' {
+		// drive letter, such as /C:/foo
+		p = p[1:]
+	}
+	return filepath.FromSlash(p)
+}
+
+func isLocalHost(host string) bool {
+	if host == "" || strings.EqualFold(host, "localhost") {
+		return true
+	}
+	hostname, err := os.Hostname()
+	return err == nil && strings.EqualFold(host, hostname)
+}
@@ -0,0 +1,167 @@
+package goclip
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestFileURI(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix paths")
+	}
+	tests := []struct {
+		path string
+		uri  string
+	}{
+		{"/tmp/file.txt", "file:///tmp/file.txt"},
+		{"/tmp/my file.txt", "file:///tmp/my%20file.txt"},
+		{"/tmp/a#b?c%d", "file:///tmp/a%23b%3Fc%25d"},
+		{"/tmp/été", "file:///tmp/%C3%A9t%C3%A9"},
+	}
+	for _, test := range tests {
+		if uri := fileURI(test.path); uri != test.uri {
+			t.Errorf("fileURI(%q) = %q, expected %q", test.path, uri, test.uri)
+		}
+	}
+}
+
+func TestParseURIList(t *testing.T) {
+	remote := ""
+	if runtime.GOOS == "windows" {
+		// remote hosts are accessed as UNC paths
+		remote = `\\otherhost\share\file.txt`
+	}
+
+	tests := []struct {
+		name string
+		line string
+		uri  string
+		path string
+	}{
+		{"plain", "file:///tmp/file.txt", "file:///tmp/file.txt", filepath.FromSlash("/tmp/file.txt")},
+		{"percent-decoding", "file:///tmp/my%20file%23%3F%25.txt", "file:///tmp/my%20file%23%3F%25.txt", filepath.FromSlash("/tmp/my file#?%.txt")},
+		{"utf-8", "file:///tmp/%C3%A9t%C3%A9", "file:///tmp/%C3%A9t%C3%A9", filepath.FromSlash("/tmp/été")},
+		{"localhost", "file://localhost/tmp/file.txt", "file://localhost/tmp/file.txt", filepath.FromSlash("/tmp/file.txt")},
+		{"remote host", "file://otherhost/share/file.txt", "file://otherhost/share/file.txt", remote},
+		{"smb", "smb://server/share/file.txt", "smb://server/share/file.txt", ""},
+		{"sftp", "sftp://user@host/home/user/file.txt", "sftp://user@host/home/user/file.txt", ""},
+	}
+	for _, test := range tests {
+		refs := parseURIList([]byte(test.line + "\r\n"))
+		if len(refs) != 1 {
+			t.Errorf("%s: got %d refs, expected 1", test.name, len(refs))
+			continue
+		}
+		if uri := refs[0].URI.String(); uri != test.uri {
+			t.Errorf("%s: got URI %q, expected %q", test.name, uri, test.uri)
+		}
+		if refs[0].Path != test.path {
+			t.Errorf("%s: got path %q, expected %q", test.name, refs[0].Path, test.path)
+		}
+	}
+
+	// comments, blank lines and invalid entries are skipped
+	refs := parseURIList([]byte("# comment\r\n\r\nfile:///a\r\nnot a uri\r\nfile:///b\r\n\x00"))
+	if len(refs) != 2 || refs[0].URI.Path != "/a" || refs[1].URI.Path != "/b" {
+		t.Errorf("got refs %v, expected /a and /b", refs)
+	}
+}
+
+func TestParseCopiedFiles(t *testing.T) {
+	tests := []struct {
+		name string
+		buf  string
+		op   FileOperation
+		uris []string
+	}{
+		{"copy", "copy\nfile:///tmp/a\nfile:///tmp/b", FileCopy, []string{"file:///tmp/a", "file:///tmp/b"}},
+		{"cut", "cut\nfile:///tmp/a%20b\n", FileMove, []string{"file:///tmp/a%20b"}},
+		{"crlf", "cut\r\nfile:///tmp/a\r\n", FileMove, []string{"file:///tmp/a"}},
+		{"header only", "copy", FileCopy, nil},
+	}
+	for _, test := range tests {
+		res := parseCopiedFiles([]byte(test.buf))
+		if res.Operation != test.op {
+			t.Errorf("%s: got operation %s, expected %s", test.name, res.Operation, test.op)
+		}
+		var uris []string
+		for _, ref := range res.Refs {
+			uris = append(uris, ref.URI.String())
+		}
+		if !reflect.DeepEqual(uris, test.uris) {
+			t.Errorf("%s: got %q, expected %q", test.name, uris, test.uris)
+		}
+	}
+}
+
+func TestFileRefsKDECut(t *testing.T) {
+	tests := []struct {
+		name string
+		cut  string
+		op   FileOperation
+	}{
+		{"no target", "", FileCopy},
+		{"cut", "1", FileMove},
+		{"copy", "0", FileCopy},
+	}
+	for _, test := range tests {
+		data := &StaticData{Options: []DataOption{
+			&StaticDataOption{StaticType: "text/uri-list", StaticData: []byte("file:///tmp/a\r\n")},
+		}}
+		if test.cut != "" {
+			data.Options = append(data.Options, &StaticDataOption{StaticType: "application/x-kde-cutselection", StaticData: []byte(test.cut)})
+		}
+		refs, err := data.FileRefs(context.Background())
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if refs.Operation != test.op {
+			t.Errorf("%s: got operation %s, expected %s", test.name, refs.Operation, test.op)
+		}
+	}
+}
+
+func TestFilesRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for _, name := range []string{"plain.txt", "with space.txt", "hash#.txt", "percent%20.txt", "été.txt"} {
+		paths = append(paths, filepath.Join(dir, name))
+	}
+	if runtime.GOOS != "windows" {
+		// not a valid character in windows file names
+		paths = append(paths, filepath.Join(dir, "question?.txt"))
+	}
+
+	for _, op := range []FileOperation{FileCopy, FileMove} {
+		data := FilesWithOperation(op, paths...)
+
+		refs, err := data.FileRefs(context.Background())
+		if err != nil {
+			t.Fatalf("%s: %s", op, err)
+		}
+		if refs.Operation != op {
+			t.Errorf("%s: got operation %s", op, refs.Operation)
+		}
+		if got := refs.Paths(); !reflect.DeepEqual(got, paths) {
+			t.Errorf("%s: got %q, expected %q", op, got, paths)
+		}
+
+		// text/uri-list on its own, as read by applications not
+		// supporting the gnome format
+		buf, err := data.GetFormat(context.Background(), "text/uri-list")
+		if err != nil {
+			t.Fatalf("%s: %s", op, err)
+		}
+		var got []string
+		for _, ref := range parseURIList(buf) {
+			got = append(got, ref.Path)
+		}
+		if !reflect.DeepEqual(got, paths) {
+			t.Errorf("%s: uri-list got %q, expected %q", op, got, paths)
+		}
+	}
+}
@@ -8,8 +8,6 @@ import (
 // Type represents the type of data stored in the clipboard
 type Type int
 
-var i = doInit()
-
 const (
 	// Invalid represents an invalid or unsupported clipboard data type
 	Invalid Type = iota
@@ -21,22 +19,46 @@ const (
 	FileList
 )
 
+// Available returns nil if the default clipboard can be used, or the reason it
+// cannot, such as ErrNoDisplay when running without a graphical session. All
+// the errors returned when no clipboard system is available match ErrNoSys.
+func Available() error {
+	_, err := getDefault()
+	return err
+}
+
 // Copy copies the given values to the default clipboard
 func Copy(ctx context.Context, values ...interface{}) error {
-	value, err := spawnValue(values...)
+	return CopyTo(ctx, Default, values...)
+}
+
+// CopyTo copies the given values to the specified clipboard board
+func CopyTo(ctx context.Context, board Board, values ...interface{}) error {
+	c, err := getDefault()
 	if err != nil {
 		return err
 	}
-	return i.copy(ctx, Default, value)
+	return c.CopyTo(ctx, board, values...)
 }
 
-// CopyTo copies the given values to the specified clipboard board
-func CopyTo(ctx context.Context, board Board, values ...interface{}) error {
-	value, err := spawnValue(values...)
+// CopyQueue copies a list of values to the specified board, served one after
+// another. See Clipboard.CopyQueue.
+func CopyQueue(ctx context.Context, board Board, items ...interface{}) error {
+	c, err := getDefault()
 	if err != nil {
 		return err
 	}
-	return i.copy(ctx, board, value)
+	return c.CopyQueue(ctx, board, items...)
+}
+
+// IsOwner returns true if the data last copied to the specified board is
+// still there. See Clipboard.IsOwner.
+func IsOwner(board Board) bool {
+	c, err := getDefault()
+	if err != nil {
+		return false
+	}
+	return c.IsOwner(board)
 }
 
 // Paste retrieves data from the default clipboard
@@ -46,5 +68,57 @@ func Paste(ctx context.Context) (Data, error) {
 
 // PasteFrom retrieves data from the specified clipboard board
 func PasteFrom(ctx context.Context, from Board) (Data, error) {
-	return i.paste(ctx, from)
+	c, err := getDefault()
+	if err != nil {
+		return nil, err
+	}
+	return c.PasteFrom(ctx, from)
+}
+
+// Persist ensures that data copied to the default clipboard remains available
+// after the program exits. See Clipboard.Persist.
+func Persist(ctx context.Context) error {
+	c, err := getDefault()
+	if err != nil {
+		return err
+	}
+	return c.Persist(ctx)
+}
+
+// Manage makes the default clipboard act as a clipboard manager until ctx is
+// cancelled. See Clipboard.Manage.
+func Manage(ctx context.Context) error {
+	c, err := getDefault()
+	if err != nil {
+		return err
+	}
+	return c.Manage(ctx)
+}
+
+// Shutdown closes the default clipboard, releasing its resources such as the
+// connection to the X server. Data copied to the clipboard is handed to the
+// clipboard manager first if possible; copy nothing to a board beforehand to
+// clear it instead. The default clipboard is opened again if needed by later
+// calls.
+func Shutdown(ctx context.Context) error {
+	stdLk.Lock()
+	c := std
+	std = nil
+	stdLk.Unlock()
+
+	if c == nil {
+		return nil
+	}
+	return c.Close(ctx)
+}
+
+// FetchFormats retrieves the data available on the specified clipboard board
+// in the given formats. Formats that are not available are not included in
+// the result.
+func FetchFormats(ctx context.Context, board Board, formats ...string) (map[string][]byte, error) {
+	c, err := getDefault()
+	if err != nil {
+		return nil, err
+	}
+	return c.FetchFormats(ctx, board, formats...)
 }
@@ -15,7 +15,6 @@ import (
 	"fmt"
 	"image"
 	"image/png"
-	"log"
 	"os"
 	"sync"
 	"unsafe"
@@ -106,7 +105,7 @@ func (cb macOSClipboard) GetFormat(ctx context.Context, fmt string) ([]byte, err
 				return nil, err
 			}
 		} else {
-			return nil, os.ErrNotExist
+			return nil, &Error{Op: "fetch", Board: Default, Format: fmt, Err: ErrFormatUnavailable}
 		}
 	}
 
@@ -126,7 +125,7 @@ func (cb macOSClipboard) GetFormat(ctx context.Context, fmt string) ([]byte, err
 		}
 	}
 
-	return nil, os.ErrNotExist
+	return nil, &Error{Op: "fetch", Board: Default, Format: fmt, Err: ErrFormatUnavailable}
 }
 
 func (cb macOSClipboard) GetAllFormats() ([]DataOption, error) {
@@ -168,10 +167,18 @@ func (cb *macOSClipboard) Type() Type {
 }
 
 func (cb *macOSClipboard) FileList() ([]string, error) {
+	refs, err := cb.FileRefs(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return refs.Paths(), nil
+}
+
+func (cb *macOSClipboard) FileRefs(ctx context.Context) (*FileRefList, error) {
 	if cb.Type() != FileList {
 		return nil, ErrDataNotFileList
 	}
-	return nil, nil
+	return &FileRefList{Refs: parseURIList(cb.data)}, nil
 }
 
 func (cb *macOSClipboard) performRead(types ...Type) error {
@@ -223,25 +230,37 @@ func (cb *macOSClipboard) processRead() error {
 	return nil
 }
 
+func init() {
+	RegisterBackend("darwin", func(ctx context.Context, cfg *Config) (Backend, error) {
+		return doInit(), nil
+	})
+}
+
 func doInit() *internal {
-	log.Printf("goclip: [darwin] opening general pasteboard")
+	logger().Debug("opening general pasteboard")
 	sub := C.cocoaPbFactory()
 	return &internal{sub: sub, pollch: make(chan struct{})}
 }
 
-func (i *internal) copy(ctx context.Context, board Board, values ...interface{}) error {
+func (i *internal) Copy(ctx context.Context, board Board, value Data) error {
 	if board != Default {
 		// only default board on macos
 		return ErrNoBoard
 	}
-	for _, v := range values {
-		if s, ok := v.(string); ok {
-			// ok that's text
-			log.Printf("goclip: set text to %s", s)
-			C.pasteWriteAddText(C.CString(s), C.int(len(s)))
-			C.pasteWrite(i.sub)
-			return nil
+	if value.Type() == Invalid {
+		C.pasteClear(i.sub)
+		return nil
+	}
+	if value.Type() == Text {
+		s, err := value.ToText(ctx)
+		if err != nil {
+			return err
 		}
+		// ok that's text
+		logger().Debug("copying text", "text", s)
+		C.pasteWriteAddText(C.CString(s), C.int(len(s)))
+		C.pasteWrite(i.sub)
+		return nil
 	}
 	return ErrFormatUnavailable
 }
@@ -256,6 +275,10 @@ func (i *internal) info(ctx context.Context, board Board) (Data, error) {
 	return i.spawnData(), nil
 }
 
+func (i *internal) Paste(ctx context.Context, board Board) (Data, error) {
+	return i.paste(ctx, board, Text, Image, FileList)
+}
+
 func (i *internal) paste(ctx context.Context, board Board, types ...Type) (Data, error) {
 	if board != Default {
 		return nil, ErrNoBoard
@@ -286,13 +309,21 @@ func (i *internal) runMonitor() {
 	}()
 }
 
-func (i *internal) monitor(mon *Monitor) error {
+func (i *internal) Fetch(ctx context.Context, board Board, format string) ([]byte, error) {
+	data, err := i.Paste(ctx, board)
+	if err != nil {
+		return nil, err
+	}
+	return data.GetFormat(ctx, format)
+}
+
+func (i *internal) Monitor(mon *Monitor) error {
 	i.startMon.Do(i.runMonitor)
 	i.mon = append(i.mon, mon)
 	return nil
 }
 
-func (i *internal) unmonitor(mon *Monitor) error {
+func (i *internal) Unmonitor(mon *Monitor) error {
 	// locate & remove from i.mon
 	for n, v := range i.mon {
 		if v == mon {
@@ -305,7 +336,7 @@ func (i *internal) unmonitor(mon *Monitor) error {
 
 func (i *internal) triggerData(data Data) {
 	for _, m := range i.mon {
-		m.fire(data)
+		m.Fire(data)
 	}
 }
 
@@ -313,10 +344,14 @@ func (i *internal) spawnData() *macOSClipboard {
 	return &macOSClipboard{i: i}
 }
 
-func (i *internal) poll(m *Monitor) error {
+func (i *internal) Poll(m *Monitor) error {
 	select {
 	case i.pollch <- struct{}{}:
 	default:
 	}
 	return nil
 }
+
+func (i *internal) Close() error {
+	return nil
+}
@@ -34,6 +34,7 @@ ClipboardInternal *cocoaPbFactory();
 int cocoaPbChangeCount(ClipboardInternal *sub);
 void pasteWriteAddText(char* data, int len);
 void pasteWrite(ClipboardInternal *sub);
+void pasteClear(ClipboardInternal *sub);
 
 void readClipboard(ClipboardInternal *i, ClipboardTypeFilter *filter);
 void readInformation(ClipboardInternal *i);
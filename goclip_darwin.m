@@ -76,6 +76,10 @@ void pasteWriteAddText(char* data, int len) {
 	[ns_clip release]; // pastewrite owns
 }
 
+void pasteClear(ClipboardInternal *i) {
+	[i->pb clearContents];
+}
+
 void pasteWrite(ClipboardInternal *i) {
 	if(pasteWriteItems == NULL) {
 		return;
@@ -26,11 +26,14 @@ import "C"
 
 import (
 	"context"
-	"log"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"os"
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 	"unsafe"
 )
 
@@ -39,31 +42,107 @@ type evData struct {
 	selection C.xcb_atom_t
 	property  C.xcb_atom_t
 	target    C.xcb_atom_t
+	err       error // error reported by the X server, if any
 }
 
 // represents one value in clipboard (can become invalid if not used quick enough)
 type atom struct {
+	i     *internal
 	name  string
-	value C.xcb_atom_t // uint32
 	board Board
 }
 
 type internal struct {
-	dpy *C.xcb_connection_t
-	win C.xcb_window_t
-	op  sync.Once
-	mon []*Monitor
+	display string
+	screen  int
+
+	dpy  *C.xcb_connection_t
+	win  C.xcb_window_t
+	useL sync.RWMutex // held while using the connection outside of the event loop
+	op   sync.Once
+	mon  []*Monitor
 
 	atoms   map[string]C.xcb_atom_t // C.xcb_atom_t is an alias of uint32
 	atomsLk sync.RWMutex
 
 	query_ext *C.xcb_query_extension_reply_t
 
-	expectEv  map[Board]chan evData
-	expectEvL sync.RWMutex
+	pending   map[uint64]*pendingRequest
+	reqSeq    uint64
+	freeProps []C.xcb_atom_t
+	propSeq   int
+	pendingL  sync.Mutex
+
+	propWait  map[C.xcb_atom_t]chan C.xcb_timestamp_t
+	propWaitL sync.Mutex
+
+	timeL sync.Mutex
 
-	copyVal  map[Board]Data
+	incr  map[incrKey]*incrTransfer
+	incrL sync.Mutex
+
+	copyVal  map[Board]*ownedBoard
 	copyValL sync.RWMutex
+
+	tasks     []func() // functions to run on the event loop
+	tasksDone bool     // event loop has stopped
+	tasksL    sync.Mutex
+
+	persistCh chan evData
+
+	done      chan struct{} // closed when the clipboard is closed
+	stopped   chan struct{} // closed once the event loop has stopped
+	closeOnce sync.Once
+
+	lost  chan struct{} // closed when the connection is lost, nil if never connected
+	connL sync.RWMutex
+
+	initErr error // why the first connection failed
+
+	managing  bool
+	snapshot  *StaticData
+	snapTag   ownerTag // owner the snapshot was taken from
+	clipOwner ownerTag // current owner of the clipboard
+	mgrL      sync.Mutex
+}
+
+// ownedBoard is a board we own, with the time we acquired it
+type ownedBoard struct {
+	data   Data
+	time   C.xcb_timestamp_t
+	opts   *CopyOptions
+	serves int
+	queue  []Data
+	done   chan struct{}
+}
+
+// sensitive returns true if the copy is limited in time or in number of
+// pastes, in which case the data is scrubbed once not needed anymore
+func (o *ownedBoard) sensitive() bool {
+	return o.opts != nil && (o.opts.TTL > 0 || o.opts.MaxServes > 0)
+}
+
+// scrub overwrites data with zeroes if possible
+func scrub(data Data) {
+	if s, ok := data.(*StaticData); ok {
+		s.Scrub()
+	}
+}
+
+// disown notifies the owner of a board that its data is not on it anymore.
+// If the data was set to expire, it is scrubbed on the event loop so it is not
+// altered while a request for it is being served.
+func (i *internal) disown(own *ownedBoard) {
+	close(own.done)
+	if own.opts == nil {
+		return
+	}
+	if own.sensitive() {
+		i.post(func() { scrub(own.data) })
+	}
+	if own.opts.OnLost != nil {
+		go own.opts.OnLost()
+	}
 }
 
 var fmtTypes = map[string]Type{
@@ -92,40 +171,34 @@ func guessType(l []atom) Type {
 	return Invalid
 }
 
-func doInit() *internal {
-	// do not do anything here, instead we connect at the first use of any method
-	return &internal{
-		atoms:    make(map[string]C.xcb_atom_t),
-		expectEv: make(map[Board]chan evData),
-		copyVal:  make(map[Board]Data),
-	}
+func init() {
+	RegisterBackend("x11", func(ctx context.Context, cfg *Config) (Backend, error) {
+		i := doInit(cfg)
+		if err := i.ready(); err != nil {
+			return nil, err
+		}
+		return i, nil
+	})
 }
 
-// boardEvChan returns a channel for a given board, creating it if needed
-func (i *internal) boardEvChan(b Board) chan evData {
-	i.expectEvL.RLock()
-	ch, ok := i.expectEv[b]
-	i.expectEvL.RUnlock()
-
-	if ok {
-		return ch
-	}
-
-	i.expectEvL.Lock()
-	defer i.expectEvL.Unlock()
-
-	// re-check, in case of race condition
-	if ch, ok = i.expectEv[b]; ok {
-		return ch
+func doInit(cfg *Config) *internal {
+	// do not do anything here, the connection is established by open
+	return &internal{
+		display:   cfg.Display,
+		screen:    cfg.Screen,
+		atoms:     make(map[string]C.xcb_atom_t),
+		pending:   make(map[uint64]*pendingRequest),
+		propWait:  make(map[C.xcb_atom_t]chan C.xcb_timestamp_t),
+		incr:      make(map[incrKey]*incrTransfer),
+		persistCh: make(chan evData, 1),
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+		copyVal:   make(map[Board]*ownedBoard),
 	}
-
-	ch = make(chan evData, 4)
-	i.expectEv[b] = ch
-	return ch
 }
 
 func (i *internal) open() {
-	log.Printf("goclip: creating new connection to X11 ...")
+	logger().Debug("connecting to X11", "display", i.display)
 
 	var wg sync.WaitGroup
 	wg.Add(1)
@@ -133,107 +206,460 @@ func (i *internal) open() {
 	wg.Wait()
 }
 
+func (i *internal) Paste(ctx context.Context, board Board) (Data, error) {
+	release, err := i.use()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return i.paste(ctx, board)
+}
+
 func (i *internal) paste(ctx context.Context, board Board) (Data, error) {
-	i.op.Do(i.open)
 	atom, found := i.atomCk(linuxBoardName(board))
 	if !found {
-		return nil, os.ErrNotExist
+		return nil, ErrNoBoard
 	}
 
-	ch := i.boardEvChan(board)
-	C.xcb_convert_selection(i.dpy, i.win, atom, i.atom("TARGETS"), i.atom("FOO"), C.XCB_CURRENT_TIME)
-	C.xcb_flush(i.dpy)
+	prop := i.allocProperty()
+	res, err := i.convertSelection(ctx, atom, i.atom("TARGETS"), prop)
+	if err != nil {
+		return nil, err
+	}
+	defer i.freeProperty(prop)
+
+	if res == C.XCB_ATOM_NONE {
+		// nobody owns the selection, or the owner refused to list targets
+		return nil, ErrNoData
+	}
+	return i.spawnData(atom, res), nil
+}
+
+func (i *internal) Copy(ctx context.Context, board Board, value Data) error {
+	return i.CopyWithOptions(ctx, board, value, nil)
+}
 
-	// TODO check property
+func (i *internal) CopyWithOptions(ctx context.Context, board Board, value Data, opts *CopyOptions) error {
+	release, err := i.use()
+	if err != nil {
+		return err
+	}
+	own, err := i.copyTo(ctx, board, value, opts)
+	release()
+	if err != nil || own == nil || opts == nil || !opts.Wait {
+		return err
+	}
 
+	// the data is lost when we are closed, which ends the wait
 	select {
-	case sEv := <-ch:
-		if sEv.property == 0 {
-			return nil, os.ErrNotExist
-		}
-		data := i.spawnData(sEv.selection, sEv.property)
-		return data, nil
+	case <-own.done:
+		return nil
 	case <-ctx.Done():
-		return nil, ctx.Err()
+		return ctx.Err()
 	}
 }
 
-func (i *internal) copy(ctx context.Context, board Board, value Data) error {
-	i.op.Do(i.open)
-	if i.win == 0 {
-		// not available
-		return ErrNoSys
-	}
-
+// copyTo puts value on board, and returns the board we now own, or nil if
+// the board was cleared
+func (i *internal) copyTo(ctx context.Context, board Board, value Data, opts *CopyOptions) (*ownedBoard, error) {
 	// ok let's do this
 	atom, ok := i.atomCk(linuxBoardName(board))
 	if !ok {
-		return ErrNoBoard
+		return nil, ErrNoBoard
 	}
 
 	if value.Type() == Invalid {
 		// special case
-		C.xcb_set_selection_owner(i.dpy, C.XCB_NONE, atom, C.XCB_CURRENT_TIME)
+		t, err := i.serverTime(ctx)
+		if err != nil {
+			return nil, err
+		}
+		C.xcb_set_selection_owner(i.dpy, C.XCB_NONE, atom, t)
+		C.xcb_flush(i.dpy)
+
+		i.lose(board, C.XCB_CURRENT_TIME)
+		return nil, nil
+	}
+
+	return i.own(ctx, board, atom, value, opts)
+}
+
+// IsOwner returns true if we still own the given board
+func (i *internal) IsOwner(board Board) bool {
+	i.copyValL.RLock()
+	defer i.copyValL.RUnlock()
+
+	_, ok := i.copyVal[board]
+	return ok
+}
+
+// lose forgets the data we own on board, unless we acquired it after t, and
+// notifies its owner
+func (i *internal) lose(board Board, t C.xcb_timestamp_t) {
+	i.copyValL.Lock()
+	own, ok := i.copyVal[board]
+	if !ok || (t != C.XCB_CURRENT_TIME && int32(t-own.time) < 0) {
+		i.copyValL.Unlock()
+		return
+	}
+	delete(i.copyVal, board)
+	i.copyValL.Unlock()
+
+	i.disown(own)
+}
+
+// own makes us the owner of the selection, serving the given value. ICCCM
+// forbids using CurrentTime to acquire a selection, so the ownership is taken
+// with the current server time, which is also used to answer TIMESTAMP
+// requests and to refuse requests made before we owned the selection.
+func (i *internal) own(ctx context.Context, board Board, atom C.xcb_atom_t, value Data, opts *CopyOptions) (*ownedBoard, error) {
+	t, err := i.serverTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	logger().Debug("taking ownership of selection", "board", board.String())
+	i.copyValL.Lock()
+	prev, replaced := i.copyVal[board]
+	own := &ownedBoard{data: value, time: t, opts: opts, done: make(chan struct{})}
+	if opts != nil {
+		own.queue = opts.Queue
+	}
+	i.copyVal[board] = own
+	i.copyValL.Unlock()
+
+	if replaced {
+		i.disown(prev)
+	}
+
+	C.xcb_set_selection_owner(i.dpy, i.win, atom, t)
+	C.xcb_flush(i.dpy)
+
+	if i.selectionOwner(atom) != i.win {
+		// someone acquired the selection after us
 		i.copyValL.Lock()
-		defer i.copyValL.Unlock()
+		if own, ok := i.copyVal[board]; ok && own.time == t {
+			delete(i.copyVal, board)
+		}
+		i.copyValL.Unlock()
+		return nil, ErrNotOwner
+	}
 
-		i.copyVal[board] = nil
-		return nil
+	if opts != nil && opts.TTL > 0 {
+		time.AfterFunc(opts.TTL, func() {
+			i.post(func() { i.release(board, own) })
+		})
+	}
+	return own, nil
+}
+
+// release clears board if it still holds the given data. It must be called
+// from the event loop.
+func (i *internal) release(board Board, own *ownedBoard) {
+	if i.closed() {
+		// our selections are released when we disconnect
+		return
 	}
 
-	log.Printf("goclip: set self owner of selection %s for %s", value, board)
 	i.copyValL.Lock()
-	defer i.copyValL.Unlock()
-	i.copyVal[board] = value
-	C.xcb_set_selection_owner_checked(i.dpy, i.win, atom, C.XCB_CURRENT_TIME)
+	if i.copyVal[board] != own {
+		// data was replaced already
+		i.copyValL.Unlock()
+		return
+	}
+	delete(i.copyVal, board)
+	t := own.time
+	i.copyValL.Unlock()
+
+	// releasing with the time we acquired the selection has no effect if
+	// another client acquired it since
+	C.xcb_set_selection_owner(i.dpy, C.XCB_NONE, i.atom(linuxBoardName(board)), t)
 	C.xcb_flush(i.dpy)
-	//res := C.xcb_get_selection_owner_reply(i.dpy, cookie, nil)
-	//log.Printf("result %+v", res)
-	return nil
+
+	i.disown(own)
+}
+
+// serverTime returns the current X server time, which is obtained by making
+// a zero-length change to a property of our window and waiting for the
+// resulting PropertyNotify event. It must not be called from the event loop.
+func (i *internal) serverTime(ctx context.Context) (C.xcb_timestamp_t, error) {
+	i.timeL.Lock()
+	defer i.timeL.Unlock()
+
+	prop := i.atom("GOCLIP_TIMESTAMP")
+	notify := i.watchProperty(prop)
+	defer i.unwatchProperty(prop)
+
+	C.xcb_change_property(i.dpy, C.XCB_PROP_MODE_APPEND, i.win, prop, C.XCB_ATOM_INTEGER, 32, 0, nil)
+	C.xcb_flush(i.dpy)
+
+	select {
+	case t := <-notify:
+		return t, nil
+	case <-i.done:
+		return 0, ErrClosed
+	case <-i.lostCh():
+		return 0, ErrDisconnected
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// selectionOwner returns the current owner of a selection
+func (i *internal) selectionOwner(selection C.xcb_atom_t) C.xcb_window_t {
+	reply := C.xcb_get_selection_owner_reply(i.dpy, C.xcb_get_selection_owner(i.dpy, selection), nil)
+	if reply == nil {
+		return C.XCB_NONE
+	}
+	defer C.free(unsafe.Pointer(reply))
+	return reply.owner
+}
+
+func (i *internal) Fetch(ctx context.Context, b Board, format string) ([]byte, error) {
+	release, err := i.use()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return i.fetch(ctx, b, i.atom(format))
 }
 
 func (i *internal) fetch(ctx context.Context, b Board, format C.xcb_atom_t) ([]byte, error) {
 	selection, ok := i.atomCk(linuxBoardName(b))
 	if !ok {
-		return nil, os.ErrNotExist
+		return nil, i.fetchError(b, format, ErrNoBoard)
 	}
 
-	ch := i.boardEvChan(b)
-	C.xcb_convert_selection(i.dpy, i.win, selection, format, i.atom("FOO"), C.XCB_CURRENT_TIME)
-	C.xcb_flush(i.dpy)
+	prop := i.allocProperty()
+	res, err := i.convertSelection(ctx, selection, format, prop)
+	if err != nil {
+		return nil, i.fetchError(b, format, err)
+	}
+	if res == C.XCB_ATOM_NONE {
+		i.freeProperty(prop)
+		return nil, i.fetchError(b, format, ErrFormatUnavailable)
+	}
 
-	select {
-	case sEv := <-ch:
-		//log.Printf("received fetch data %+v", sEv)
-		// data is here
-		var buf []byte
-		offset := C.uint32_t(0)
+	buf, err := i.readConverted(ctx, res, format)
+	if err != nil {
+		// an INCR transfer may still write to the property
+		return nil, i.fetchError(b, format, err)
+	}
+	i.freeProperty(prop)
+	return buf, nil
+}
 
-		for {
-			reply := C.xcb_get_property_reply(i.dpy, C.xcb_get_property(i.dpy, 1, i.win, sEv.property, format, offset, 16384), nil)
-			tmp := C.GoBytes(C.xcb_get_property_value(reply), C.xcb_get_property_value_length(reply))
-			//log.Printf("performed one read, len=%d bytes_after=%d all=%+v", C.xcb_get_property_value_length(reply), reply.bytes_after, reply)
-			buf = append(buf, tmp...)
-			if reply.bytes_after > 0 {
-				offset += C.uint32_t(len(tmp)) / 4
-				C.free(unsafe.Pointer(reply))
-				continue
-			}
-			C.free(unsafe.Pointer(reply))
-			return buf, nil
+// fetchError returns err as the error of fetching format from board
+func (i *internal) fetchError(b Board, format C.xcb_atom_t, err error) error {
+	return opError("fetch", b, i.resolveAtom(format), err)
+}
+
+// FetchMultiple retrieves multiple formats at once using the MULTIPLE target,
+// or one by one if the owner of the selection does not support it.
+func (i *internal) FetchMultiple(ctx context.Context, b Board, formats []string) (map[string][]byte, error) {
+	release, err := i.use()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	data, err := i.paste(ctx, b)
+	if err != nil {
+		return nil, err
+	}
+	return i.fetchFormats(ctx, b, formats, data.HasFormat("MULTIPLE"))
+}
+
+// fetchFormats retrieves multiple formats, using MULTIPLE if the owner of the
+// selection supports it
+func (i *internal) fetchFormats(ctx context.Context, b Board, formats []string, multiple bool) (map[string][]byte, error) {
+	if len(formats) < 2 || !multiple {
+		return i.fetchEach(ctx, b, formats)
+	}
+	selection, _ := i.atomCk(linuxBoardName(b))
+
+	// each target is converted into its own property
+	props := make([]C.xcb_atom_t, len(formats))
+	pairs := make([]C.xcb_atom_t, 0, len(formats)*2)
+	for n, f := range formats {
+		props[n] = i.allocProperty()
+		pairs = append(pairs, i.atom(f), props[n])
+	}
+	prop := i.allocProperty()
+	C.xcb_change_property(i.dpy, C.XCB_PROP_MODE_REPLACE, i.win, prop, i.atom("ATOM_PAIR"), 32, C.uint32_t(len(pairs)), unsafe.Pointer(&pairs[0]))
+
+	// properties of pairs are not freed on failure, as the owner may still
+	// write to them
+	sel, err := i.convertSelection(ctx, selection, i.atom("MULTIPLE"), prop)
+	if err != nil {
+		return nil, err
+	}
+	if sel == C.XCB_ATOM_NONE {
+		// MULTIPLE was refused, the properties of pairs were not used
+		i.freeProperty(prop)
+		for _, p := range props {
+			i.freeProperty(p)
 		}
-	case <-ctx.Done():
-		return nil, ctx.Err()
+		return i.fetchEach(ctx, b, formats)
+	}
+
+	// the owner updated the list of pairs, with None for failed conversions
+	buf, _, err := i.readProperty(i.win, sel, true)
+	i.freeProperty(prop)
+	if err != nil {
+		return nil, err
+	}
+	pairs = bytesToAtoms(buf)
+
+	res := make(map[string][]byte)
+	for n := range formats {
+		if 2*n+1 >= len(pairs) || pairs[2*n+1] == C.XCB_ATOM_NONE {
+			// conversion failed, property was not used
+			i.freeProperty(props[n])
+			continue
+		}
+		v, err := i.readConverted(ctx, pairs[2*n+1], i.atom(formats[n]))
+		if errors.Is(err, ErrFormatUnavailable) {
+			continue
+		}
+		if err != nil {
+			return nil, i.fetchError(b, i.atom(formats[n]), err)
+		}
+		i.freeProperty(props[n])
+		res[formats[n]] = v
+	}
+	return res, nil
+}
+
+// fetchEach retrieves formats one by one, skipping formats the owner cannot
+// convert to
+func (i *internal) fetchEach(ctx context.Context, b Board, formats []string) (map[string][]byte, error) {
+	res := make(map[string][]byte)
+	for _, f := range formats {
+		v, err := i.fetch(ctx, b, i.atom(f))
+		if errors.Is(err, ErrFormatUnavailable) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		res[f] = v
+	}
+	return res, nil
+}
+
+// readConverted reads the result of a conversion to target stored in a
+// property of our window, which may be sent using INCR. ErrFormatUnavailable is
+// returned if the owner did not store a value of a type matching target.
+func (i *internal) readConverted(ctx context.Context, prop, target C.xcb_atom_t) ([]byte, error) {
+	// watch the property before reading it since reading deletes it, which
+	// starts the transfer if the owner uses INCR
+	notify := i.watchProperty(prop)
+	defer i.unwatchProperty(prop)
+
+	buf, typ, err := i.readProperty(i.win, prop, true)
+	if err != nil {
+		return nil, err
+	}
+	if typ == i.atom("INCR") {
+		return i.readIncr(ctx, prop, target, notify)
+	}
+	if !i.validReply(target, typ) {
+		return nil, ErrFormatUnavailable
 	}
+	return buf, nil
 }
 
-func (i *internal) monitor(mon *Monitor) error {
+// metaTypes are the types of the answers to targets that do not hold data
+var metaTypes = map[string]string{
+	"TARGETS":   "ATOM",
+	"TIMESTAMP": "INTEGER",
+	"MULTIPLE":  "ATOM_PAIR",
+}
+
+// validReply returns true if a value of type typ is a valid conversion to
+// target. Owners may answer text targets using any text encoding.
+func (i *internal) validReply(target, typ C.xcb_atom_t) bool {
+	switch typ {
+	case target:
+		return true
+	case C.XCB_ATOM_NONE:
+		// the property was not set
+		return false
+	}
+	if t, ok := metaTypes[i.resolveAtom(target)]; ok {
+		return typ == i.atom(t)
+	}
+	return i.isTextAtom(target) && i.isTextAtom(typ)
+}
+
+// isTextAtom returns true if a is a text target or type
+func (i *internal) isTextAtom(a C.xcb_atom_t) bool {
+	switch name := i.resolveAtom(a); name {
+	case "UTF8_STRING", "STRING", "TEXT", "COMPOUND_TEXT":
+		return true
+	default:
+		return strings.HasPrefix(name, "text/")
+	}
+}
+
+// readProperty reads the whole value of a property of a window, optionally
+// deleting it, and returns its value and type
+func (i *internal) readProperty(win C.xcb_window_t, prop C.xcb_atom_t, del bool) ([]byte, C.xcb_atom_t, error) {
+	var deleteProp C.uint8_t
+	if del {
+		deleteProp = 1
+	}
+	var buf []byte
+	offset := C.uint32_t(0)
+
+	for {
+		reply := C.xcb_get_property_reply(i.dpy, C.xcb_get_property(i.dpy, deleteProp, win, prop, C.XCB_GET_PROPERTY_TYPE_ANY, offset, 16384), nil)
+		if reply == nil {
+			return nil, 0, ErrNoData
+		}
+		tmp := C.GoBytes(C.xcb_get_property_value(reply), C.xcb_get_property_value_length(reply))
+		//log.Printf("performed one read, len=%d bytes_after=%d all=%+v", C.xcb_get_property_value_length(reply), reply.bytes_after, reply)
+		buf = append(buf, tmp...)
+		typ := reply._type
+		after := reply.bytes_after
+		C.free(unsafe.Pointer(reply))
+
+		if after > 0 {
+			offset += C.uint32_t(len(tmp)) / 4
+			continue
+		}
+		return buf, typ, nil
+	}
+}
+
+// watchProperty returns a channel receiving the time at which a new value is
+// set for the given property on our window
+func (i *internal) watchProperty(prop C.xcb_atom_t) chan C.xcb_timestamp_t {
+	i.propWaitL.Lock()
+	defer i.propWaitL.Unlock()
+
+	ch := make(chan C.xcb_timestamp_t, 1)
+	i.propWait[prop] = ch
+	return ch
+}
+
+func (i *internal) unwatchProperty(prop C.xcb_atom_t) {
+	i.propWaitL.Lock()
+	defer i.propWaitL.Unlock()
+
+	delete(i.propWait, prop)
+}
+
+func (i *internal) Monitor(mon *Monitor) error {
 	i.op.Do(i.open)
 	i.mon = append(i.mon, mon)
 	return nil
 }
 
-func (i *internal) unmonitor(mon *Monitor) error {
+func (i *internal) Unmonitor(mon *Monitor) error {
 	// locate & remove from i.mon
 	for n, v := range i.mon {
 		if v == mon {
@@ -244,10 +670,161 @@ func (i *internal) unmonitor(mon *Monitor) error {
 	return os.ErrNotExist
 }
 
-func (i *internal) poll(mon *Monitor) error {
+func (i *internal) Poll(mon *Monitor) error {
 	return nil
 }
 
+// Close stops the event loop, destroys our window and disconnects from the X
+// server. Data we own is not available anymore, and Persist should be called
+// first to hand it to the clipboard manager.
+func (i *internal) Close() error {
+	// do not connect if this was not done yet
+	i.op.Do(func() { close(i.stopped) })
+
+	i.closeOnce.Do(func() {
+		close(i.done)
+		// wake up the event loop so it notices we are closing
+		i.wakeUp()
+	})
+
+	<-i.stopped
+	return nil
+}
+
+// wakeUp sends an event to our window, so the event loop runs the posted
+// functions or notices we are closing
+func (i *internal) wakeUp() {
+	// the lock is not available while the event loop replaces the
+	// connection, which it checks afterwards. Waiting for it could also
+	// deadlock when called while using the connection.
+	if !i.useL.TryRLock() {
+		return
+	}
+	defer i.useL.RUnlock()
+
+	if i.dpy == nil || i.isDisconnected() {
+		// event loop is not running, or waiting to reconnect
+		return
+	}
+
+	ev := &C.xcb_client_message_event_t{
+		response_type: C.XCB_CLIENT_MESSAGE,
+		format:        32,
+		window:        i.win,
+		_type:         i.atom("GOCLIP_WAKEUP"),
+	}
+	C.xcb_send_event(i.dpy, 0, i.win, C.XCB_EVENT_MASK_NO_EVENT, (*C.char)(unsafe.Pointer(ev)))
+	C.xcb_flush(i.dpy)
+}
+
+// post runs f on the event loop, where requests for data we own are served.
+// Functions posted once the event loop has stopped run right away.
+func (i *internal) post(f func()) {
+	i.tasksL.Lock()
+	if i.tasksDone {
+		i.tasksL.Unlock()
+		f()
+		return
+	}
+	i.tasks = append(i.tasks, f)
+	i.tasksL.Unlock()
+
+	i.wakeUp()
+}
+
+// runTasks runs the functions posted to the event loop. If stop is true, the
+// event loop is stopping and functions posted later run right away.
+func (i *internal) runTasks(stop bool) {
+	i.tasksL.Lock()
+	tasks := i.tasks
+	i.tasks = nil
+	if stop {
+		i.tasksDone = true
+	}
+	i.tasksL.Unlock()
+
+	for _, f := range tasks {
+		f()
+	}
+}
+
+// ready connects to the X server if needed, and returns an error if the
+// clipboard cannot be used
+func (i *internal) ready() error {
+	i.op.Do(i.open)
+	if i.initErr != nil {
+		return i.initErr
+	}
+	if i.closed() {
+		return ErrClosed
+	}
+	if i.isDisconnected() {
+		return ErrDisconnected
+	}
+	if i.lostCh() == nil {
+		return ErrNoSys
+	}
+	return nil
+}
+
+// use returns an error if the clipboard cannot be used. Otherwise, the
+// connection to the X server is not replaced until release is called. Calls
+// must not be nested, as the event loop waits for all users to release the
+// connection before replacing it, and waiting for it blocks new users.
+func (i *internal) use() (release func(), err error) {
+	if err := i.ready(); err != nil {
+		return nil, err
+	}
+	i.useL.RLock()
+	if err := i.ready(); err != nil {
+		// lost or closed in the meantime
+		i.useL.RUnlock()
+		return nil, err
+	}
+	return i.useL.RUnlock, nil
+}
+
+// closed returns true if Close was called
+func (i *internal) closed() bool {
+	select {
+	case <-i.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// shutdown releases everything once the event loop has stopped
+func (i *internal) shutdown() {
+	i.loseAll()
+	i.runTasks(true)
+
+	i.abortAllIncr()
+
+	// goroutines using the connection notice we are closing through done,
+	// and release it
+	i.useL.Lock()
+	defer i.useL.Unlock()
+
+	C.xcb_destroy_window(i.dpy, i.win)
+	C.xcb_flush(i.dpy)
+	C.xcb_disconnect(i.dpy)
+	i.dpy = nil
+}
+
+// loseAll forgets all the data we own, as it is going away with our window
+func (i *internal) loseAll() {
+	i.copyValL.RLock()
+	var boards []Board
+	for board := range i.copyVal {
+		boards = append(boards, board)
+	}
+	i.copyValL.RUnlock()
+	for _, board := range boards {
+		i.lose(board, C.XCB_CURRENT_TIME)
+	}
+}
+
 func (i *internal) atom(s string) C.xcb_atom_t {
 	v, _ := i.atomCk(s)
 	return v
@@ -268,9 +845,13 @@ func (i *internal) atomCk(s string) (C.xcb_atom_t, bool) {
 	// fetch atom
 	cstr := C.CString(s)
 	rep := C.xcb_intern_atom_reply(i.dpy, C.xcb_intern_atom(i.dpy, 0, C.ushort(len(s)), cstr), nil)
+	C.free(unsafe.Pointer(cstr))
+	if rep == nil {
+		// connection lost
+		return C.XCB_ATOM_NONE, false
+	}
 	a = rep.atom
 	C.free(unsafe.Pointer(rep))
-	C.free(unsafe.Pointer(cstr))
 
 	// store in cache
 	i.atomsLk.Lock()
@@ -290,6 +871,10 @@ func (i *internal) resolveAtom(a C.xcb_atom_t) string {
 	i.atomsLk.RUnlock()
 
 	reply2 := C.xcb_get_atom_name_reply(i.dpy, C.xcb_get_atom_name(i.dpy, a), nil)
+	if reply2 == nil {
+		// unknown atom, or connection lost
+		return ""
+	}
 	defer C.free(unsafe.Pointer(reply2))
 	ln := C.xcb_get_atom_name_name_length(reply2)
 	nm := C.xcb_get_atom_name_name(reply2)
@@ -303,31 +888,103 @@ func (i *internal) resolveAtom(a C.xcb_atom_t) string {
 
 func (i *internal) run(wg *sync.WaitGroup) {
 	runtime.LockOSThread()
-	var defaultScreen C.int
+	defer close(i.stopped)
 
-	i.dpy = C.xcb_connect(nil, &defaultScreen)
-	if i.dpy == nil {
+	if err := i.connect(); err != nil {
+		logger().Warn("failed to connect to X11", "display", i.display, "error", err)
+		i.initErr = err
 		wg.Done()
 		return
 	}
-	if errNo := C.xcb_connection_has_error(i.dpy); errNo != 0 {
-		log.Printf("goclip: failed to connect to xcb: error #%d", errNo)
-		return
+	wg.Done()
+
+	for {
+		for {
+			//log.Printf("goclip: wait for event")
+			ev := C.xcb_wait_for_event(i.dpy)
+			if ev == nil {
+				logger().Warn("lost connection to X11", "display", i.display)
+				break
+			}
+			i.eventHandler(ev)
+			i.runTasks(false)
+			if i.closed() {
+				break
+			}
+		}
+		if i.closed() {
+			break
+		}
+
+		i.disconnected()
+		if !i.reconnect() {
+			// closed while disconnected
+			i.loseAll()
+			i.runTasks(true)
+			return
+		}
+		// functions posted while disconnected
+		i.runTasks(false)
+		if i.closed() {
+			// closed while reconnecting, Close did not wake us up
+			break
+		}
+		go i.reown()
 	}
-	i.query_ext = C.xcb_get_extension_data(i.dpy, &C.xcb_xfixes_id)
-	if i.query_ext == nil {
-		log.Printf("goclip: failed to find xfixes")
+	i.shutdown()
+}
+
+// connect opens a connection to the X server and creates our window
+func (i *internal) connect() error {
+	i.useL.Lock()
+	defer i.useL.Unlock()
+
+	var defaultScreen C.int
+	var display *C.char
+
+	if i.display != "" {
+		display = C.CString(i.display)
+	} else if os.Getenv("DISPLAY") == "" {
+		return ErrNoDisplay
+	}
+	dpy := C.xcb_connect(display, &defaultScreen)
+	C.free(unsafe.Pointer(display))
+	if i.screen >= 0 {
+		defaultScreen = C.int(i.screen)
+	}
+	if dpy == nil {
+		return ErrConnRefused
+	}
+	switch errNo := C.xcb_connection_has_error(dpy); errNo {
+	case 0:
+	case C.XCB_CONN_CLOSED_PARSE_ERR:
+		C.xcb_disconnect(dpy)
+		return fmt.Errorf("%w: invalid display name %q", ErrNoDisplay, i.display)
+	case C.XCB_CONN_CLOSED_INVALID_SCREEN:
+		C.xcb_disconnect(dpy)
+		return fmt.Errorf("%w: invalid screen", ErrConnRefused)
+	default:
+		// also returned when authentication fails
+		C.xcb_disconnect(dpy)
+		return fmt.Errorf("%w: xcb error #%d", ErrConnRefused, errNo)
+	}
+	i.query_ext = C.xcb_get_extension_data(dpy, &C.xcb_xfixes_id)
+	if i.query_ext == nil || i.query_ext.present == 0 {
+		C.xcb_disconnect(dpy)
+		return ErrNoXFixes
 	}
+	i.dpy = dpy
 
 	// let's cache our atoms
-	for _, s := range []string{"UTF8_STRING", "CLIPBOARD", "PRIMARY", "SECONDARY", "TARGETS", "STRING", "TEXT", "FOO"} {
+	for _, s := range []string{"UTF8_STRING", "CLIPBOARD", "PRIMARY", "SECONDARY", "TARGETS", "STRING", "TEXT", "INCR", "GOCLIP_WAKEUP"} {
 		i.atom(s)
 	}
 
 	screen := C.screen_of_display(i.dpy, defaultScreen)
 	if screen == nil {
-		// failed
-		return
+		C.xcb_disconnect(i.dpy)
+		i.dpy = nil
+		return fmt.Errorf("%w: screen %d does not exist", ErrConnRefused, defaultScreen)
 	}
 	selection_window := C.xcb_generate_id(i.dpy)
 	mask := C.uint(C.XCB_CW_BACK_PIXEL | C.XCB_CW_OVERRIDE_REDIRECT | C.XCB_CW_EVENT_MASK)
@@ -348,17 +1005,11 @@ func (i *internal) run(wg *sync.WaitGroup) {
 	//log.Printf("goclip: created")
 
 	C.xcb_flush(i.dpy)
-	wg.Done()
 
-	for {
-		//log.Printf("goclip: wait for event")
-		ev := C.xcb_wait_for_event(i.dpy)
-		if ev == nil {
-			log.Printf("goclip: lost connection to X11")
-			break
-		}
-		i.eventHandler(ev)
-	}
+	i.connL.Lock()
+	i.lost = make(chan struct{})
+	i.connL.Unlock()
+	return nil
 }
 
 func (i *internal) eventHandler(ev *C.xcb_generic_event_t) {
@@ -371,49 +1022,83 @@ func (i *internal) eventHandler(ev *C.xcb_generic_event_t) {
 	case 0:
 		// Error
 		generr := (*C.xcb_generic_error_t)(unsafe.Pointer(ev))
-		log.Printf("Got error %d from request %d:%d", generr.error_code, generr.major_code, generr.minor_code)
+		if !i.failRequest(generr) {
+			logger().Warn("X11 error", "code", generr.error_code, "major", generr.major_code, "minor", generr.minor_code)
+		}
 	case C.XCB_PROPERTY_NOTIFY: // 28
-		//pEv := (*C.xcb_property_notify_event_t)(unsafe.Pointer(ev))
+		pEv := (*C.xcb_property_notify_event_t)(unsafe.Pointer(ev))
 		//log.Printf("property notify=%+v", pEv)
 		// notify=&{response_type:28 pad0:0 sequence:73 window:79691776 atom:485 time:3100655541 state:0 pad1:[0 0 0]}
-		// ignore
+		if pEv.state == C.XCB_PROPERTY_DELETE {
+			// a requestor may be waiting for the next INCR chunk
+			i.continueIncr(pEv.window, pEv.atom)
+			return
+		}
+		if pEv.window != i.win {
+			return
+		}
+
+		i.propWaitL.Lock()
+		ch, ok := i.propWait[pEv.atom]
+		i.propWaitL.Unlock()
+
+		if ok {
+			select {
+			case ch <- pEv.time:
+			default:
+				// already notified
+			}
+		}
+	case C.XCB_CLIENT_MESSAGE: // 33
+		// sent by wakeUp, posted functions run after each event
+	case C.XCB_SELECTION_CLEAR: // 29
+		cEv := (*C.xcb_selection_clear_event_t)(unsafe.Pointer(ev))
+		// another client took ownership of a selection we owned
+		i.lose(i.linuxAtomToBoard(cEv.selection), cEv.time)
 	case C.XCB_SELECTION_REQUEST: // 30
 		rEv := (*C.xcb_selection_request_event_t)(unsafe.Pointer(ev))
-		i.handleSelectionRequest(rEv)
-
-		// send completion notify
-		notify := &C.xcb_selection_notify_event_t{
-			response_type: C.XCB_SELECTION_NOTIFY,
-			time:          rEv.time,
-			requestor:     rEv.requestor,
-			selection:     rEv.selection,
-			target:        rEv.target,
-			property:      rEv.property,
+		if rEv.selection == i.atom("CLIPBOARD_MANAGER") {
+			// we are the clipboard manager, answer may be sent later
+			i.handleManagerRequest(*rEv)
+			return
 		}
+		property := i.handleSelectionRequest(rEv)
 
-		C.xcb_send_event(i.dpy, 0, rEv.requestor, C.XCB_EVENT_MASK_NO_EVENT, (*C.char)(unsafe.Pointer(notify)))
+		// send completion notify
+		i.sendSelectionNotify(rEv, property)
 	case C.XCB_SELECTION_NOTIFY: // 31
 		sEv := (*C.xcb_selection_notify_event_t)(unsafe.Pointer(ev))
 		//log.Printf("got selection notify = %+v", sEv)
 		// got selection notify = &{response_type:159 pad0:0 sequence:67 time:0 requestor:96468992 selection:1 target:485 property:485}
 
+		if sEv.selection == i.atom("CLIPBOARD_MANAGER") {
+			// clipboard manager is done saving our data
+			select {
+			case i.persistCh <- evData{selection: sEv.selection, target: sEv.target, property: sEv.property}:
+			default:
+			}
+			return
+		}
+
 		switch sEv.property {
 		case i.atom("TARGETS"):
 			// regular event, read data & pass to triggerSel
 			data := i.spawnData(sEv.selection, sEv.property)
 			// triggerData happens in a separate thread
 			go i.triggerData(data)
-			return
-		case i.atom("FOO"):
-			//log.Printf("received FOO board event, sending to chan")
-			b := i.linuxAtomToBoard(sEv.selection)
-			select {
-			case i.boardEvChan(b) <- evData{selection: sEv.selection, target: sEv.target, property: sEv.property}:
-			default:
-				log.Printf("WARNING: clipboard event dropped due to queue full for %s", b)
+			if sEv.selection == i.atom("CLIPBOARD") && i.isManaging() {
+				// keep a copy in case the owner goes away, unless the
+				// clipboard changed owner since we asked for its targets
+				if tag := i.clipboardOwner(); tag.time == sEv.time {
+					go i.takeSnapshot(data, tag)
+				}
 			}
+			return
 		default:
-			log.Printf("unhandled target: %v", sEv.target)
+			// answer to a paste or fetch
+			if !i.completeRequest(sEv) {
+				logger().Debug("unexpected selection notify", "target", i.resolveAtom(sEv.target))
+			}
 		}
 
 	case i.query_ext.first_event + C.XCB_XFIXES_SELECTION_NOTIFY:
@@ -422,49 +1107,144 @@ func (i *internal) eventHandler(ev *C.xcb_generic_event_t) {
 			// do not worry about ourselves
 			return
 		}
+		if fEv.subtype != C.XCB_XFIXES_SELECTION_EVENT_SET_SELECTION_OWNER {
+			// owner window was destroyed or its client closed
+			if fEv.selection == i.atom("CLIPBOARD") && i.isManaging() {
+				go i.restoreSnapshot()
+			}
+			return
+		}
+		if fEv.selection == i.atom("CLIPBOARD") && i.isManaging() {
+			i.clipboardOwnerChanged(ownerTag{owner: fEv.owner, time: fEv.selection_timestamp})
+		}
 		//log.Printf("xfixes event, new owner=%+v", fEv)
 		// &{response_type:86 subtype:0 sequence:15 window:79691776 owner:58721633 selection:1 timestamp:3069285688 selection_timestamp:3069285672 pad0:[0 0 0 0 0 0 0 0]}
 		C.xcb_convert_selection(i.dpy, i.win, fEv.selection, i.atom("TARGETS"), i.atom("TARGETS"), fEv.selection_timestamp) //C.XCB_CURRENT_TIME)
 
 	default:
-		log.Printf("goclip: got unknown event type %d", ev.response_type)
+		logger().Debug("unknown X11 event", "type", ev.response_type)
 	}
 }
 
-func (i *internal) handleSelectionRequest(rEv *C.xcb_selection_request_event_t) {
-	log.Printf("rev = %+v", rEv)
+// sendSelectionNotify informs the requestor that a conversion is complete.
+// A property of None means the conversion failed.
+func (i *internal) sendSelectionNotify(rEv *C.xcb_selection_request_event_t, property C.xcb_atom_t) {
+	notify := &C.xcb_selection_notify_event_t{
+		response_type: C.XCB_SELECTION_NOTIFY,
+		time:          rEv.time,
+		requestor:     rEv.requestor,
+		selection:     rEv.selection,
+		target:        rEv.target,
+		property:      property,
+	}
+
+	C.xcb_send_event(i.dpy, 0, rEv.requestor, C.XCB_EVENT_MASK_NO_EVENT, (*C.char)(unsafe.Pointer(notify)))
+}
+
+// handleSelectionRequest answers a request from another client for data we
+// own, and returns the property to report in the notify event, or None if the
+// conversion failed
+func (i *internal) handleSelectionRequest(rEv *C.xcb_selection_request_event_t) C.xcb_atom_t {
 	// &{response_type:30 pad0:0 sequence:18 time:3095213350 owner:79691776 requestor:79691776 selection:477 target:485 property:485}
 
 	board := i.linuxAtomToBoard(rEv.selection)
 
 	i.copyValL.RLock()
-	data, ok := i.copyVal[board]
+	own, ok := i.copyVal[board]
 	i.copyValL.RUnlock()
 
 	if !ok {
-		return // :(
+		return C.XCB_ATOM_NONE // :(
+	}
+	if rEv.time != C.XCB_CURRENT_TIME && int32(rEv.time-own.time) < 0 {
+		// request was made before we acquired the selection
+		return C.XCB_ATOM_NONE
+	}
+
+	property := rEv.property
+	if property == C.XCB_ATOM_NONE {
+		// obsolete requestor, the target is used as property
+		property = rEv.target
+	}
+
+	if rEv.target == i.atom("MULTIPLE") {
+		ok, data := i.convertMultiple(board, own, rEv.requestor, property)
+		if !ok {
+			return C.XCB_ATOM_NONE
+		}
+		if data {
+			i.served(board, own)
+		}
+		return property
 	}
+	if !i.convert(board, own, rEv.requestor, rEv.target, property) {
+		return C.XCB_ATOM_NONE
+	}
+	if i.isDataTarget(rEv.target) {
+		i.served(board, own)
+	}
+	return property
+}
 
-	tgt := i.resolveAtom(rEv.target)
-	prop := i.resolveAtom(rEv.property)
+// isDataTarget returns true if target asks for the data itself, rather than
+// information about it such as the list of targets
+func (i *internal) isDataTarget(target C.xcb_atom_t) bool {
+	return target != i.atom("TARGETS") && target != i.atom("TIMESTAMP") && target != i.atom("MULTIPLE")
+}
 
-	log.Printf("rev board=%s target=%s prop=%s", board, tgt, prop)
+// served counts a paste of data we own. Once it reached the maximum number of
+// pastes, the next queued item is served, or the board is cleared.
+func (i *internal) served(board Board, own *ownedBoard) {
+	if own.opts == nil || own.opts.MaxServes <= 0 {
+		return
+	}
+
+	i.copyValL.Lock()
+	own.serves++
+	if own.serves < own.opts.MaxServes {
+		i.copyValL.Unlock()
+		return
+	}
+	if len(own.queue) > 0 {
+		// move on to the next item
+		prev := own.data
+		own.data, own.queue = own.queue[0], own.queue[1:]
+		own.serves = 0
+		i.copyValL.Unlock()
+
+		scrub(prev)
+		return
+	}
+	i.copyValL.Unlock()
+
+	i.release(board, own)
+}
+
+// convert writes data converted to target in the requestor's property, and
+// returns false if the conversion failed
+func (i *internal) convert(board Board, own *ownedBoard, requestor C.xcb_window_t, target, property C.xcb_atom_t) bool {
+	data := own.data
+	tgt := i.resolveAtom(target)
+	prop := i.resolveAtom(property)
+
+	logger().Debug("selection request", "board", board.String(), "target", tgt, "property", prop, "requestor", uint32(requestor))
 
 	switch tgt {
 	case "TARGETS":
 		var targets []C.xcb_atom_t
-		targets = append(targets, i.atom("TARGETS"), i.atom("SAVE_TARGETS")) //, i.atom("MULTIPLE"))
-
-		switch data.Type() {
-		case Text:
-			// add text targets
-			targets = append(targets, i.atom("UTF8_STRING"), i.atom("COMPOUND_TEXT"), i.atom("TEXT"), i.atom("STRING"))
-		}
+		targets = append(targets, i.atom("TARGETS"), i.atom("SAVE_TARGETS"), i.atom("MULTIPLE"), i.atom("TIMESTAMP"))
 
 		opts, err := data.GetAllFormats()
 		if err != nil {
-			log.Printf("failed to fetch formats: %s", err)
-			break
+			logger().Warn("failed to list formats", "board", board.String(), "error", err)
+			return false
+		}
+		for _, opt := range opts {
+			if opt.Type() == Text {
+				// add text targets
+				targets = append(targets, i.atom("UTF8_STRING"), i.atom("COMPOUND_TEXT"), i.atom("TEXT"), i.atom("STRING"))
+				break
+			}
 		}
 		for _, opt := range opts {
 			m := opt.Mime()
@@ -478,29 +1258,107 @@ func (i *internal) handleSelectionRequest(rEv *C.xcb_selection_request_event_t)
 			}
 		}
 
-		C.xcb_change_property(i.dpy, C.XCB_PROP_MODE_REPLACE, rEv.requestor, rEv.property, C.XCB_ATOM_ATOM, 8*C.uint8_t(unsafe.Sizeof(C.xcb_atom_t(0))), C.uint32_t(len(targets)), unsafe.Pointer(&targets[0]))
-		C.xcb_flush(i.dpy)
-		return
+		C.xcb_change_property(i.dpy, C.XCB_PROP_MODE_REPLACE, requestor, property, C.XCB_ATOM_ATOM, 8*C.uint8_t(unsafe.Sizeof(C.xcb_atom_t(0))), C.uint32_t(len(targets)), unsafe.Pointer(&targets[0]))
+		return true
+	case "TIMESTAMP":
+		// time at which we acquired the selection
+		ts := []C.uint32_t{C.uint32_t(own.time)}
+		C.xcb_change_property(i.dpy, C.XCB_PROP_MODE_REPLACE, requestor, property, C.XCB_ATOM_INTEGER, 32, 1, unsafe.Pointer(&ts[0]))
+		return true
+	case "MULTIPLE":
+		// cannot be nested
+		return false
 	default:
-		log.Printf("fetching value %s", tgt)
+		data = i.authorize(board, own, requestor, tgt)
+		if data == nil {
+			// denied
+			return false
+		}
 		switch tgt {
 		case "TEXT", "UTF8_STRING", "STRING", "COMPOUND_TEXT":
 			tgt = "text/plain"
 		}
 		buf, err := data.GetFormat(context.Background(), tgt)
 		if err != nil {
-			log.Printf("failed to fetch: %s", err)
-			break
+			logger().Info("failed to convert selection", "board", board.String(), "target", tgt, "requestor", uint32(requestor), "error", err)
+			return false
 		}
-		log.Printf("goclip: got %d bytes, setting", len(buf))
-		C.xcb_change_property(i.dpy, C.XCB_PROP_MODE_REPLACE, rEv.requestor, rEv.property, rEv.target, 8, C.uint32_t(len(buf)), unsafe.Pointer(&buf[0]))
-		C.xcb_flush(i.dpy)
-		return
+		logger().Debug("serving selection", "board", board.String(), "target", tgt, "requestor", uint32(requestor), "size", len(buf))
+		if len(buf) > i.incrThreshold() {
+			// too large for a single request
+			i.sendIncr(requestor, property, target, buf)
+			return true
+		}
+		var ptr unsafe.Pointer
+		if len(buf) > 0 {
+			ptr = unsafe.Pointer(&buf[0])
+		}
+		C.xcb_change_property(i.dpy, C.XCB_PROP_MODE_REPLACE, requestor, property, target, 8, C.uint32_t(len(buf)), ptr)
+		return true
 	}
+}
 
-	// if still here it means it failed
-	C.xcb_change_property(i.dpy, C.XCB_PROP_MODE_REPLACE, rEv.requestor, rEv.property, C.XCB_ATOM_NONE, 0, 0, nil)
-	C.xcb_flush(i.dpy)
+// authorize passes a request for data to the OnRequest handler of the copy,
+// if any, and returns the data to serve or nil if the request was denied
+func (i *internal) authorize(board Board, own *ownedBoard, requestor C.xcb_window_t, format string) Data {
+	if own.opts == nil || own.opts.OnRequest == nil {
+		return own.data
+	}
+
+	req := &Request{
+		Board:     board,
+		Format:    format,
+		Data:      own.data,
+		Requestor: uint32(requestor),
+		Time:      time.Now(),
+	}
+	if buf, _, err := i.readProperty(requestor, C.XCB_ATOM_WM_CLASS, false); err == nil {
+		// instance and class names, each followed by a NUL byte
+		if parts := strings.Split(string(buf), "\x00"); len(parts) > 1 {
+			req.Class = parts[1]
+		}
+	}
+	if buf, _, err := i.readProperty(requestor, i.atom("_NET_WM_PID"), false); err == nil && len(buf) == 4 {
+		req.PID = int(binary.NativeEndian.Uint32(buf))
+	}
+	return own.opts.OnRequest(req)
+}
+
+// convertMultiple handles the MULTIPLE target. The requestor's property holds
+// a list of (target, property) pairs, each of which is converted. Pairs that
+// could not be converted have their property replaced with None. It returns
+// false if the request is invalid, and whether data was served.
+func (i *internal) convertMultiple(board Board, own *ownedBoard, requestor C.xcb_window_t, property C.xcb_atom_t) (ok, data bool) {
+	buf, _, err := i.readProperty(requestor, property, false)
+	if err != nil {
+		return false, false
+	}
+	pairs := bytesToAtoms(buf)
+	if len(pairs) < 2 {
+		return false, false
+	}
+
+	for n := 0; n+1 < len(pairs); n += 2 {
+		if pairs[n+1] == C.XCB_ATOM_NONE || !i.convert(board, own, requestor, pairs[n], pairs[n+1]) {
+			pairs[n+1] = C.XCB_ATOM_NONE
+			continue
+		}
+		if i.isDataTarget(pairs[n]) {
+			data = true
+		}
+	}
+
+	C.xcb_change_property(i.dpy, C.XCB_PROP_MODE_REPLACE, requestor, property, i.atom("ATOM_PAIR"), 32, C.uint32_t(len(pairs)), unsafe.Pointer(&pairs[0]))
+	return true, data
+}
+
+// bytesToAtoms converts the value of a property of format 32 to atoms
+func bytesToAtoms(buf []byte) []C.xcb_atom_t {
+	res := make([]C.xcb_atom_t, len(buf)/4)
+	if len(res) > 0 {
+		copy(unsafe.Slice((*byte)(unsafe.Pointer(&res[0])), len(res)*4), buf)
+	}
+	return res
 }
 
 func (i *internal) linuxAtomToBoard(sel C.xcb_atom_t) Board {
@@ -524,6 +1382,10 @@ func (i *internal) spawnData(sel, prop C.xcb_atom_t) Data {
 
 	// prop==TARGETS (always)
 	reply := C.xcb_get_property_reply(i.dpy, C.xcb_get_property(i.dpy, 1, i.win, prop, C.XCB_ATOM_ATOM, 0, 300), nil)
+	if reply == nil {
+		// connection lost
+		return emptyData{}
+	}
 	defer C.free(unsafe.Pointer(reply))
 
 	atomsPtr := C.xcb_get_property_value(reply)
@@ -537,7 +1399,7 @@ func (i *internal) spawnData(sel, prop C.xcb_atom_t) Data {
 	for _, atomV := range atoms {
 		f := i.resolveAtom(atomV)
 		//log.Printf("%d: %s (%x)", c, f, atomV)
-		formats = append(formats, atom{name: f, board: b, value: atomV})
+		formats = append(formats, atom{i: i, name: f, board: b})
 	}
 
 	return &StaticData{TargetBoard: b, Options: formats}
@@ -545,7 +1407,7 @@ func (i *internal) spawnData(sel, prop C.xcb_atom_t) Data {
 
 func (i *internal) triggerData(data Data) {
 	for _, m := range i.mon {
-		m.fire(data)
+		m.Fire(data)
 	}
 }
 
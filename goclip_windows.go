@@ -46,6 +46,12 @@ var (
 	lstrcpy      = kernel32.NewProc("lstrcpyW")
 )
 
+func init() {
+	RegisterBackend("windows", func(ctx context.Context, cfg *Config) (Backend, error) {
+		return doInit(), nil
+	})
+}
+
 func doInit() *internal {
 	return &internal{}
 }
@@ -76,12 +82,16 @@ func (i *internal) open(ctx context.Context) error {
 	return err
 }
 
-func (i *internal) copy(ctx context.Context, board Board, values ...interface{}) error {
+func (i *internal) Copy(ctx context.Context, board Board, value Data) error {
 	if board != Default {
 		// Windows only supports the default clipboard
 		return ErrNoBoard
 	}
 
+	if value.Type() == Invalid {
+		return i.clear(ctx)
+	}
+
 	// Open clipboard
 	if err := i.open(ctx); err != nil {
 		return err
@@ -94,8 +104,8 @@ func (i *internal) copy(ctx context.Context, board Board, values ...interface{})
 		return errors.New("failed to empty clipboard")
 	}
 
-	for _, v := range values {
-		if s, ok := v.(string); ok {
+	if value.Type() == Text {
+		if s, err := value.ToText(ctx); err == nil {
 			// Text data
 			// Allocate global memory for the text
 			text16, err := syscall.UTF16FromString(s)
@@ -133,8 +143,8 @@ func (i *internal) copy(ctx context.Context, board Board, values ...interface{})
 
 			return nil
 		}
-		// Additional data types (images, file lists) would be implemented here
 	}
+	// Additional data types (images, file lists) would be implemented here
 
 	return ErrFormatUnavailable
 }
@@ -167,7 +177,7 @@ func (i *internal) formats() []uint32 {
 	return res
 }
 
-func (i *internal) paste(ctx context.Context, board Board) (Data, error) {
+func (i *internal) Paste(ctx context.Context, board Board) (Data, error) {
 	if board != Default {
 		return nil, ErrNoBoard
 	}
@@ -222,7 +232,15 @@ func (i *internal) paste(ctx context.Context, board Board) (Data, error) {
 	return nil, ErrNoData
 }
 
-func (i *internal) monitor(mon *Monitor) error {
+func (i *internal) Fetch(ctx context.Context, board Board, format string) ([]byte, error) {
+	data, err := i.Paste(ctx, board)
+	if err != nil {
+		return nil, err
+	}
+	return data.GetFormat(ctx, format)
+}
+
+func (i *internal) Monitor(mon *Monitor) error {
 	// Basic implementation of clipboard monitoring
 	go func() {
 		var lastFormats []uint32
@@ -251,10 +269,10 @@ func (i *internal) monitor(mon *Monitor) error {
 				lastFormats = currentFormats
 
 				// Get data and trigger callback
-				data, err := i.paste(context.Background(), Default)
+				data, err := i.Paste(context.Background(), Default)
 				if err == nil {
 					// Fire the monitor's callback with the new data
-					mon.fire(data)
+					mon.Fire(data)
 				}
 			}
 
@@ -265,13 +283,17 @@ func (i *internal) monitor(mon *Monitor) error {
 	return nil
 }
 
-func (i *internal) unmonitor(mon *Monitor) error {
+func (i *internal) Unmonitor(mon *Monitor) error {
 	// In a real implementation, we would stop the monitoring goroutine
 	// For now, just return success
 	return nil
 }
 
-func (i *internal) poll(mon *Monitor) error {
+func (i *internal) Poll(mon *Monitor) error {
 	// Trigger a check right now
 	return nil
 }
+
+func (i *internal) Close() error {
+	return nil
+}
@@ -0,0 +1,78 @@
+package goclip
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"sync"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+// imageMimes lists the formats an image is offered as, in order of preference
+var imageMimes = []string{"image/png", "image/bmp", "image/jpeg", "image/tiff"}
+
+// imageDataOption is a DataOption holding an image, only encoded in its
+// format when the data is actually requested
+type imageDataOption struct {
+	img  image.Image
+	mime string
+
+	once sync.Once
+	buf  []byte
+	err  error
+}
+
+// SpawnImage returns a Data object offering the given image in multiple image
+// formats
+func SpawnImage(img image.Image) Data {
+	return &StaticData{Options: imageOptions(img)}
+}
+
+func imageOptions(img image.Image) []DataOption {
+	var res []DataOption
+	for _, m := range imageMimes {
+		res = append(res, &imageDataOption{img: img, mime: m})
+	}
+	return res
+}
+
+func (o *imageDataOption) Type() Type {
+	return Image
+}
+
+func (o *imageDataOption) Mime() string {
+	return o.mime
+}
+
+func (o *imageDataOption) Data(ctx context.Context) ([]byte, error) {
+	o.once.Do(func() {
+		o.buf, o.err = encodeImage(o.img, o.mime)
+	})
+	return o.buf, o.err
+}
+
+func encodeImage(img image.Image, mime string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	var err error
+
+	switch mime {
+	case "image/png":
+		err = png.Encode(buf, img)
+	case "image/bmp":
+		err = bmp.Encode(buf, img)
+	case "image/jpeg":
+		err = jpeg.Encode(buf, img, &jpeg.Options{Quality: 90})
+	case "image/tiff":
+		err = tiff.Encode(buf, img, &tiff.Options{Compression: tiff.Deflate})
+	default:
+		return nil, ErrFormatUnavailable
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,206 @@
+package goclip
+
+/*
+#include <stdlib.h>
+#include <xcb/xcb.h>
+*/
+import "C"
+
+import (
+	"context"
+	"time"
+	"unsafe"
+)
+
+const (
+	// incrMaxSize is the size above which data is always sent using INCR,
+	// even if the server would accept larger requests
+	incrMaxSize = 1024 * 1024
+	// incrChunkSize is the size of each chunk sent using INCR
+	incrChunkSize = 64 * 1024
+	// incrTimeout is how long a requestor can take to read a chunk before
+	// the transfer is abandoned
+	incrTimeout = 10 * time.Second
+)
+
+// incrKey identifies an outgoing INCR transfer
+type incrKey struct {
+	requestor C.xcb_window_t
+	property  C.xcb_atom_t
+}
+
+// incrTransfer is the state of an outgoing INCR transfer
+type incrTransfer struct {
+	target C.xcb_atom_t
+	data   []byte
+	pos    int
+	timer  *time.Timer
+}
+
+// readIncr receives data sent using the INCR protocol. Each chunk is written
+// by the owner to prop, and reading it (which deletes it) asks for the next
+// chunk, until a zero-length chunk marks the end of the transfer.
+func (i *internal) readIncr(ctx context.Context, prop, target C.xcb_atom_t, notify chan C.xcb_timestamp_t) ([]byte, error) {
+	var buf []byte
+
+	for {
+		select {
+		case <-notify:
+		case <-i.done:
+			return nil, ErrClosed
+		case <-i.lostCh():
+			return nil, ErrDisconnected
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		chunk, typ, err := i.readProperty(i.win, prop, true)
+		if err != nil {
+			return nil, err
+		}
+		if len(chunk) == 0 {
+			return buf, nil
+		}
+		if buf == nil && !i.validReply(target, typ) {
+			// the transfer is abandoned, and times out on the owner's side
+			return nil, ErrFormatUnavailable
+		}
+		buf = append(buf, chunk...)
+	}
+}
+
+// incrThreshold returns the size above which data has to be sent using INCR
+func (i *internal) incrThreshold() int {
+	// maximum request length is in 4 bytes units, keep room for the
+	// ChangeProperty request header
+	limit := int(C.xcb_get_maximum_request_length(i.dpy))*4 - 32
+	if limit > incrMaxSize {
+		return incrMaxSize
+	}
+	return limit
+}
+
+// sendIncr starts sending data to a requestor using the INCR protocol. The
+// property is set to INCR, and each time the requestor deletes it the next
+// chunk is written, until a zero-length chunk marks the end of the transfer.
+// The transfer uses its own copy of data, as the copied value may be scrubbed
+// before it completes.
+func (i *internal) sendIncr(requestor C.xcb_window_t, property, target C.xcb_atom_t, data []byte) {
+	key := incrKey{requestor: requestor, property: property}
+	t := &incrTransfer{target: target, data: append([]byte(nil), data...)}
+
+	i.incrL.Lock()
+	if prev, ok := i.incr[key]; ok {
+		// requestor is re-using the same property, drop the previous transfer
+		prev.end()
+	}
+	i.incr[key] = t
+	t.timer = time.AfterFunc(incrTimeout, func() {
+		i.post(func() { i.abortIncr(key, t) })
+	})
+	i.incrL.Unlock()
+
+	// we need to know when the requestor deletes the property
+	mask := []C.uint32_t{C.XCB_EVENT_MASK_PROPERTY_CHANGE}
+	C.xcb_change_window_attributes(i.dpy, requestor, C.XCB_CW_EVENT_MASK, unsafe.Pointer(&mask[0]))
+
+	size := []C.uint32_t{C.uint32_t(len(data))}
+	C.xcb_change_property(i.dpy, C.XCB_PROP_MODE_REPLACE, requestor, property, i.atom("INCR"), 32, 1, unsafe.Pointer(&size[0]))
+}
+
+// continueIncr is called when a property is deleted on a window, and sends
+// the next chunk if this is part of an INCR transfer
+func (i *internal) continueIncr(requestor C.xcb_window_t, property C.xcb_atom_t) {
+	key := incrKey{requestor: requestor, property: property}
+
+	i.incrL.Lock()
+	t, ok := i.incr[key]
+	if !ok {
+		i.incrL.Unlock()
+		return
+	}
+	// the chunk is copied as the transfer may end while it is being sent
+	chunk := t.data[t.pos:]
+	if len(chunk) > incrChunkSize {
+		chunk = chunk[:incrChunkSize]
+	}
+	chunk = append([]byte(nil), chunk...)
+	t.pos += len(chunk)
+	if len(chunk) == 0 {
+		// final zero-length chunk, transfer is complete
+		t.end()
+		delete(i.incr, key)
+	} else {
+		t.timer.Reset(incrTimeout)
+	}
+	i.incrL.Unlock()
+
+	var ptr unsafe.Pointer
+	if len(chunk) > 0 {
+		ptr = unsafe.Pointer(&chunk[0])
+	}
+	C.xcb_change_property(i.dpy, C.XCB_PROP_MODE_REPLACE, requestor, property, t.target, 8, C.uint32_t(len(chunk)), ptr)
+	clear(chunk)
+
+	if len(chunk) == 0 {
+		i.releaseRequestor(requestor)
+	}
+}
+
+// abortIncr drops a transfer whose requestor stopped reading. It must be
+// called from the event loop.
+func (i *internal) abortIncr(key incrKey, t *incrTransfer) {
+	i.incrL.Lock()
+	if i.incr[key] != t {
+		// transfer already completed or replaced
+		i.incrL.Unlock()
+		return
+	}
+	delete(i.incr, key)
+	t.end()
+	i.incrL.Unlock()
+
+	logger().Warn("INCR transfer timed out", "requestor", uint32(key.requestor), "sent", t.pos, "size", len(t.data))
+	i.releaseRequestor(key.requestor)
+	C.xcb_flush(i.dpy)
+}
+
+// abortAllIncr drops all outgoing transfers, when the connection is closed or
+// lost
+func (i *internal) abortAllIncr() {
+	i.incrL.Lock()
+	defer i.incrL.Unlock()
+
+	for key, t := range i.incr {
+		t.end()
+		delete(i.incr, key)
+	}
+}
+
+// end stops the timer of a transfer and scrubs its copy of the data. It must
+// be called with incrL held.
+func (t *incrTransfer) end() {
+	t.timer.Stop()
+	clear(t.data)
+}
+
+// releaseRequestor stops listening to property changes on a requestor window
+// once no transfer is in progress with it
+func (i *internal) releaseRequestor(requestor C.xcb_window_t) {
+	if requestor == i.win {
+		// our own window, keep our event mask
+		return
+	}
+
+	i.incrL.Lock()
+	for key := range i.incr {
+		if key.requestor == requestor {
+			i.incrL.Unlock()
+			return
+		}
+	}
+	i.incrL.Unlock()
+
+	mask := []C.uint32_t{C.XCB_EVENT_MASK_NO_EVENT}
+	C.xcb_change_window_attributes(i.dpy, requestor, C.XCB_CW_EVENT_MASK, unsafe.Pointer(&mask[0]))
+}
@@ -0,0 +1,26 @@
+package goclip
+
+import (
+	"log/slog"
+	"sync/atomic"
+)
+
+var logPtr atomic.Pointer[slog.Logger]
+
+// SetLogger sets the logger receiving goclip's events. Nothing is logged by
+// default, and passing nil discards events again. Clipboard content is only
+// logged at the debug level.
+func SetLogger(l *slog.Logger) {
+	if l == nil {
+		l = slog.New(slog.DiscardHandler)
+	}
+	logPtr.Store(l)
+}
+
+// logger returns the logger set with SetLogger
+func logger() *slog.Logger {
+	if l := logPtr.Load(); l != nil {
+		return l
+	}
+	return slog.New(slog.DiscardHandler)
+}
@@ -0,0 +1,364 @@
+package goclip
+
+/*
+#include <stdlib.h>
+#include <xcb/xcb.h>
+*/
+import "C"
+
+import (
+	"context"
+	"time"
+	"unsafe"
+)
+
+// metaTargets are targets that do not hold data, and are not saved by the
+// clipboard manager
+var metaTargets = map[string]bool{
+	"TARGETS":          true,
+	"MULTIPLE":         true,
+	"TIMESTAMP":        true,
+	"SAVE_TARGETS":     true,
+	"DELETE":           true,
+	"INSERT_SELECTION": true,
+	"INSERT_PROPERTY":  true,
+	// text aliases, served from the text/plain option
+	"STRING":        true,
+	"TEXT":          true,
+	"COMPOUND_TEXT": true,
+}
+
+// ownerTag identifies an owner of the clipboard, by its window and the time
+// at which it acquired the clipboard
+type ownerTag struct {
+	owner C.xcb_window_t
+	time  C.xcb_timestamp_t
+}
+
+// persistTimeout is the maximum time given to a clipboard manager to save our
+// data
+const persistTimeout = 5 * time.Second
+
+// Persist hands the content of the clipboard we own to the clipboard manager
+// using the SAVE_TARGETS protocol, so it remains available after we exit. The
+// manager fetches the data from us, which requires the event loop to keep
+// running until it confirms or the timeout expires.
+func (i *internal) Persist(ctx context.Context) error {
+	release, err := i.use()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	i.copyValL.RLock()
+	_, ok := i.copyVal[Default]
+	i.copyValL.RUnlock()
+
+	if !ok {
+		// we do not own the clipboard, nothing to save
+		return nil
+	}
+
+	manager := i.atom("CLIPBOARD_MANAGER")
+	if i.selectionOwner(manager) == C.XCB_NONE {
+		return ErrNoManager
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, persistTimeout)
+	defer cancel()
+
+	t, err := i.serverTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	logger().Debug("asking clipboard manager to save the clipboard")
+
+	// drain any stale answer
+	select {
+	case <-i.persistCh:
+	default:
+	}
+
+	// leaving the property empty means all targets are to be saved
+	C.xcb_convert_selection(i.dpy, i.win, manager, i.atom("SAVE_TARGETS"), i.atom("GOCLIP_SAVE_TARGETS"), t)
+	C.xcb_flush(i.dpy)
+
+	select {
+	case sEv := <-i.persistCh:
+		if sEv.property == C.XCB_ATOM_NONE {
+			return ErrNoManager
+		}
+		return nil
+	case <-i.done:
+		return ErrClosed
+	case <-i.lostCh():
+		return ErrDisconnected
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Manage makes us act as the clipboard manager until ctx is cancelled. The
+// content of the clipboard is saved each time it changes, and served again
+// when its owner exits. Applications can also explicitly hand their data
+// using the SAVE_TARGETS protocol.
+func (i *internal) Manage(ctx context.Context) error {
+	release, err := i.use()
+	if err != nil {
+		return err
+	}
+	t, err := i.startManaging(ctx)
+	release()
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-i.done:
+	case <-i.lostCh():
+	}
+
+	i.mgrL.Lock()
+	i.managing = false
+	i.snapshot = nil
+	i.clipOwner = ownerTag{}
+	i.mgrL.Unlock()
+
+	release, err = i.use()
+	if err != nil {
+		// ownership is lost with the connection
+		return err
+	}
+	defer release()
+
+	manager := i.atom("CLIPBOARD_MANAGER")
+	if i.selectionOwner(manager) == i.win {
+		// release using the time we acquired it
+		C.xcb_set_selection_owner(i.dpy, C.XCB_NONE, manager, t)
+		C.xcb_flush(i.dpy)
+	}
+	return ctx.Err()
+}
+
+// startManaging takes ownership of the CLIPBOARD_MANAGER selection, and
+// returns the time it was acquired
+func (i *internal) startManaging(ctx context.Context) (C.xcb_timestamp_t, error) {
+	manager := i.atom("CLIPBOARD_MANAGER")
+	if i.selectionOwner(manager) != C.XCB_NONE {
+		return 0, ErrManagerRunning
+	}
+	t, err := i.serverTime(ctx)
+	if err != nil {
+		return 0, err
+	}
+	C.xcb_set_selection_owner(i.dpy, i.win, manager, t)
+	C.xcb_flush(i.dpy)
+	if i.selectionOwner(manager) != i.win {
+		// someone was faster than us
+		return 0, ErrManagerRunning
+	}
+
+	// the time at which the current owner acquired the clipboard is not
+	// known, it is only used to tell owners apart
+	owner := i.selectionOwner(i.atom("CLIPBOARD"))
+	tag := ownerTag{owner: owner}
+	i.mgrL.Lock()
+	i.managing = true
+	i.clipOwner = tag
+	i.mgrL.Unlock()
+
+	logger().Info("acting as clipboard manager")
+
+	// save what is currently in the clipboard, if anything
+	if owner != C.XCB_NONE && owner != i.win {
+		go func() {
+			if data, err := i.Paste(ctx, Default); err == nil {
+				i.takeSnapshot(data, tag)
+			}
+		}()
+	}
+	return t, nil
+}
+
+func (i *internal) isManaging() bool {
+	i.mgrL.Lock()
+	defer i.mgrL.Unlock()
+
+	return i.managing
+}
+
+// clipboardOwner returns the current owner of the clipboard
+func (i *internal) clipboardOwner() ownerTag {
+	i.mgrL.Lock()
+	defer i.mgrL.Unlock()
+
+	return i.clipOwner
+}
+
+// clipboardOwnerChanged is called when another client acquires the clipboard.
+// The snapshot of the previous owner is dropped, as it must not be restored
+// if the new owner goes away before its own data is saved.
+func (i *internal) clipboardOwnerChanged(tag ownerTag) {
+	i.mgrL.Lock()
+	defer i.mgrL.Unlock()
+
+	i.clipOwner = tag
+	i.snapshot = nil
+}
+
+// takeSnapshot fetches all the formats of the given clipboard data, so they
+// can be served if the owner goes away. The snapshot is only kept if tag is
+// still the owner of the clipboard once it is complete.
+func (i *internal) takeSnapshot(data Data, tag ownerTag) error {
+	release, err := i.use()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), persistTimeout)
+	defer cancel()
+
+	opts, err := data.GetAllFormats()
+	if err != nil {
+		return err
+	}
+	var formats []string
+	for _, opt := range opts {
+		if !metaTargets[opt.Mime()] {
+			formats = append(formats, opt.Mime())
+		}
+	}
+	if len(formats) == 0 {
+		return ErrNoData
+	}
+
+	res, err := i.fetchFormats(ctx, Default, formats, data.HasFormat("MULTIPLE"))
+	if err != nil {
+		return err
+	}
+
+	snapshot := &StaticData{TargetBoard: Default}
+	var untyped []DataOption
+	for _, f := range formats {
+		v, ok := res[f]
+		if !ok {
+			continue
+		}
+		if f == "UTF8_STRING" {
+			if _, found := res["text/plain;charset=utf-8"]; found {
+				continue
+			}
+			f = "text/plain;charset=utf-8"
+		}
+		opt := &StaticDataOption{StaticType: f, StaticData: v}
+		if opt.Type() == Invalid {
+			// keep formats of known type first, as the first one gives the
+			// type of the whole data
+			untyped = append(untyped, opt)
+			continue
+		}
+		snapshot.Options = append(snapshot.Options, opt)
+	}
+	snapshot.Options = append(snapshot.Options, untyped...)
+	if len(snapshot.Options) == 0 {
+		return ErrNoData
+	}
+
+	i.mgrL.Lock()
+	defer i.mgrL.Unlock()
+
+	if !i.managing || i.clipOwner != tag {
+		// the clipboard changed owner in the meantime
+		return nil
+	}
+	i.snapshot = snapshot
+	i.snapTag = tag
+	return nil
+}
+
+// restoreSnapshot takes ownership of the clipboard with the last saved data,
+// after its owner went away
+func (i *internal) restoreSnapshot() {
+	i.mgrL.Lock()
+	snapshot := i.snapshot
+	if i.snapTag != i.clipOwner {
+		// taken from a previous owner
+		snapshot = nil
+	}
+	i.mgrL.Unlock()
+
+	if snapshot == nil {
+		return
+	}
+	logger().Info("clipboard owner is gone, restoring saved data")
+
+	release, err := i.use()
+	if err != nil {
+		logger().Warn("failed to restore clipboard", "error", err)
+		return
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), persistTimeout)
+	defer cancel()
+
+	if _, err = i.own(ctx, Default, i.atom("CLIPBOARD"), snapshot, nil); err != nil {
+		logger().Warn("failed to restore clipboard", "error", err)
+	}
+}
+
+// handleManagerRequest answers requests made to us as the clipboard manager.
+// For SAVE_TARGETS, the answer is sent once the data has been saved.
+func (i *internal) handleManagerRequest(rEv C.xcb_selection_request_event_t) {
+	property := rEv.property
+	if property == C.XCB_ATOM_NONE {
+		// obsolete requestor, the target is used as property
+		property = rEv.target
+	}
+
+	switch rEv.target {
+	case i.atom("TARGETS"):
+		targets := []C.xcb_atom_t{i.atom("TARGETS"), i.atom("SAVE_TARGETS")}
+		C.xcb_change_property(i.dpy, C.XCB_PROP_MODE_REPLACE, rEv.requestor, property, C.XCB_ATOM_ATOM, 32, C.uint32_t(len(targets)), unsafe.Pointer(&targets[0]))
+		i.sendSelectionNotify(&rEv, property)
+	case i.atom("SAVE_TARGETS"):
+		if !i.isManaging() {
+			i.sendSelectionNotify(&rEv, C.XCB_ATOM_NONE)
+			return
+		}
+		// the requestor is expected to be the owner of the clipboard
+		tag := i.clipboardOwner()
+		go func() {
+			// the owner is exiting and may never answer
+			ctx, cancel := context.WithTimeout(context.Background(), persistTimeout)
+			defer cancel()
+
+			data, err := i.Paste(ctx, Default)
+			if err == nil {
+				err = i.takeSnapshot(data, tag)
+			}
+
+			release, uerr := i.use()
+			if uerr != nil {
+				// closed or disconnected, the request cannot be answered
+				return
+			}
+			defer release()
+			defer C.xcb_flush(i.dpy)
+
+			if err != nil {
+				logger().Warn("failed to save clipboard", "requestor", uint32(rEv.requestor), "error", err)
+				i.sendSelectionNotify(&rEv, C.XCB_ATOM_NONE)
+				return
+			}
+			// success is reported with a zero-length property of type NULL
+			C.xcb_change_property(i.dpy, C.XCB_PROP_MODE_REPLACE, rEv.requestor, property, i.atom("NULL"), 32, 0, nil)
+			i.sendSelectionNotify(&rEv, property)
+		}()
+	default:
+		i.sendSelectionNotify(&rEv, C.XCB_ATOM_NONE)
+	}
+}
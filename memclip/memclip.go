@@ -0,0 +1,325 @@
+// Package memclip provides an in-memory clipboard backend for goclip. It does
+// not require any system clipboard and is meant to be used to test code
+// relying on goclip in a deterministic way.
+//
+// Importing this package registers the backend as "memory", it can then be
+// selected with goclip.UseBackend("memory"), or installed directly:
+//
+//	clip := memclip.Install()
+//	goclip.Copy(ctx, "hello")
+//	clip.Take(goclip.Default, goclip.SpawnText("copied from elsewhere"))
+package memclip
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/KarpelesLab/goclip"
+)
+
+// Clipboard is an in-memory implementation of goclip.Backend. All three
+// boards are available.
+type Clipboard struct {
+	data  map[goclip.Board]*goclip.StaticData
+	owned map[goclip.Board]*copied
+	mon   []*goclip.Monitor
+	lk    sync.Mutex
+}
+
+// copied is the state of data stored on a board by Copy
+type copied struct {
+	opts   *goclip.CopyOptions
+	serves int
+	queue  []goclip.Data
+	done   chan struct{}
+}
+
+func init() {
+	goclip.RegisterBackend("memory", func(ctx context.Context, cfg *goclip.Config) (goclip.Backend, error) {
+		return New(), nil
+	})
+}
+
+// New returns a new empty in-memory clipboard
+func New() *Clipboard {
+	return &Clipboard{
+		data:  make(map[goclip.Board]*goclip.StaticData),
+		owned: make(map[goclip.Board]*copied),
+	}
+}
+
+// Install creates a new in-memory clipboard and sets it as the backend used
+// by goclip's package level functions.
+func Install() *Clipboard {
+	c := New()
+	goclip.SetBackend(c)
+	return c
+}
+
+func validBoard(board goclip.Board) bool {
+	switch board {
+	case goclip.Default, goclip.PrimarySelection, goclip.SecondarySelection:
+		return true
+	default:
+		return false
+	}
+}
+
+// Copy stores value on the given board and notifies monitors
+func (c *Clipboard) Copy(ctx context.Context, board goclip.Board, value goclip.Data) error {
+	return c.CopyWithOptions(ctx, board, value, nil)
+}
+
+// CopyWithOptions stores value on the given board, applying the given options
+func (c *Clipboard) CopyWithOptions(ctx context.Context, board goclip.Board, value goclip.Data, opts *goclip.CopyOptions) error {
+	if !validBoard(board) {
+		return goclip.ErrNoBoard
+	}
+	if opts == nil {
+		opts = &goclip.CopyOptions{}
+	}
+	cp, err := c.set(board, value, opts)
+	if err != nil || cp == nil || !opts.Wait {
+		return err
+	}
+
+	select {
+	case <-cp.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Take simulates another application taking ownership of board with the
+// given value. Monitors are notified the same way they would be for a real
+// clipboard.
+func (c *Clipboard) Take(board goclip.Board, value goclip.Data) error {
+	if !validBoard(board) {
+		return goclip.ErrNoBoard
+	}
+	_, err := c.set(board, value, nil)
+	return err
+}
+
+// IsOwner returns true if the data on board was stored by Copy, and not
+// replaced since
+func (c *Clipboard) IsOwner(board goclip.Board) bool {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	_, ok := c.owned[board]
+	return ok
+}
+
+// set replaces the data on board, notifying the previous owner if any. The
+// board is owned by us if opts is not nil, in which case the state of the copy
+// is returned.
+func (c *Clipboard) set(board goclip.Board, value goclip.Data, opts *goclip.CopyOptions) (*copied, error) {
+	if value.Type() == goclip.Invalid {
+		c.lk.Lock()
+		delete(c.data, board)
+		prev := c.disown(board)
+		c.lk.Unlock()
+
+		c.lost(prev)
+		return nil, nil
+	}
+
+	data, err := c.store(board, value)
+	if err != nil {
+		return nil, err
+	}
+
+	c.lk.Lock()
+	c.data[board] = data
+	prev := c.disown(board)
+	var cp *copied
+	if opts != nil {
+		cp = &copied{opts: opts, queue: opts.Queue, done: make(chan struct{})}
+		c.owned[board] = cp
+		if opts.TTL > 0 {
+			time.AfterFunc(opts.TTL, func() { c.expire(board, cp) })
+		}
+	}
+	mon := append([]*goclip.Monitor(nil), c.mon...)
+	c.lk.Unlock()
+
+	c.lost(prev)
+	for _, m := range mon {
+		m.Fire(c.snapshot(data))
+	}
+	return cp, nil
+}
+
+// store returns the data to store on board for value
+func (c *Clipboard) store(board goclip.Board, value goclip.Data) (*goclip.StaticData, error) {
+	formats, err := value.GetAllFormats()
+	if err != nil {
+		return nil, err
+	}
+	return &goclip.StaticData{
+		TargetBoard: board,
+		Options:     append([]goclip.DataOption(nil), formats...),
+	}, nil
+}
+
+// expire clears board if it still holds the data of the given copy. Unlike
+// system backends, the data is not scrubbed as it is shared with the values
+// returned by Paste.
+func (c *Clipboard) expire(board goclip.Board, cp *copied) {
+	c.lk.Lock()
+	if c.owned[board] != cp {
+		// data was replaced already
+		c.lk.Unlock()
+		return
+	}
+	delete(c.data, board)
+	delete(c.owned, board)
+	c.lk.Unlock()
+
+	c.lost(cp)
+}
+
+// disown forgets that we own board, and returns the copy that owned it. It
+// must be called with the lock held.
+func (c *Clipboard) disown(board goclip.Board) *copied {
+	cp := c.owned[board]
+	delete(c.owned, board)
+	return cp
+}
+
+// lost notifies the owner of a copy that its data is not on the board anymore
+func (c *Clipboard) lost(cp *copied) {
+	if cp == nil {
+		return
+	}
+	close(cp.done)
+	if cp.opts.OnLost != nil {
+		cp.opts.OnLost()
+	}
+}
+
+// snapshot returns a copy of data so callers cannot alter what is stored
+func (c *Clipboard) snapshot(data *goclip.StaticData) *goclip.StaticData {
+	return &goclip.StaticData{
+		TargetBoard: data.TargetBoard,
+		Options:     append([]goclip.DataOption(nil), data.Options...),
+	}
+}
+
+// Paste returns the data stored on the given board. Each call counts as a
+// paste for copies limited with goclip.MaxServes, and is passed to the
+// goclip.OnRequest handler of the copy with an empty format.
+func (c *Clipboard) Paste(ctx context.Context, board goclip.Board) (goclip.Data, error) {
+	return c.paste(board, "")
+}
+
+// paste returns the data stored on board, requested in the given format or in
+// all formats if empty
+func (c *Clipboard) paste(board goclip.Board, format string) (goclip.Data, error) {
+	if !validBoard(board) {
+		return nil, goclip.ErrNoBoard
+	}
+
+	c.lk.Lock()
+	data, ok := c.data[board]
+	cp := c.owned[board]
+	c.lk.Unlock()
+
+	if !ok {
+		return nil, goclip.ErrNoData
+	}
+	var res goclip.Data = c.snapshot(data)
+	if cp == nil {
+		return res, nil
+	}
+	if cp.opts.OnRequest != nil {
+		res = cp.opts.OnRequest(&goclip.Request{Board: board, Format: format, Data: res, Time: time.Now()})
+		if res == nil {
+			// denied
+			return nil, goclip.ErrNoData
+		}
+	}
+
+	var done *copied
+	c.lk.Lock()
+	if c.owned[board] == cp && cp.opts.MaxServes > 0 {
+		cp.serves++
+		if cp.serves >= cp.opts.MaxServes {
+			done = c.advance(board, cp)
+		}
+	}
+	c.lk.Unlock()
+
+	c.lost(done)
+	return res, nil
+}
+
+// advance replaces the data on board with the next queued item of cp, or
+// clears the board and returns cp if there is none. It must be called with
+// the lock held.
+func (c *Clipboard) advance(board goclip.Board, cp *copied) *copied {
+	for len(cp.queue) > 0 {
+		next := cp.queue[0]
+		cp.queue = cp.queue[1:]
+		data, err := c.store(board, next)
+		if err != nil {
+			continue
+		}
+		c.data[board] = data
+		cp.serves = 0
+		return nil
+	}
+	delete(c.data, board)
+	return c.disown(board)
+}
+
+// Fetch returns the data stored on the given board in the given format. It
+// counts as a paste the same way as Paste.
+func (c *Clipboard) Fetch(ctx context.Context, board goclip.Board, format string) ([]byte, error) {
+	data, err := c.paste(board, format)
+	if err != nil {
+		return nil, err
+	}
+	return data.GetFormat(ctx, format)
+}
+
+func (c *Clipboard) Monitor(mon *goclip.Monitor) error {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	c.mon = append(c.mon, mon)
+	return nil
+}
+
+func (c *Clipboard) Unmonitor(mon *goclip.Monitor) error {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	// locate & remove from c.mon
+	for n, v := range c.mon {
+		if v == mon {
+			c.mon = append(c.mon[:n], c.mon[n+1:]...)
+			return nil
+		}
+	}
+	return os.ErrNotExist
+}
+
+func (c *Clipboard) Poll(mon *goclip.Monitor) error {
+	// monitors are notified synchronously, nothing can be missed
+	return nil
+}
+
+// Close removes all the data stored in the clipboard
+func (c *Clipboard) Close() error {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	c.data = make(map[goclip.Board]*goclip.StaticData)
+	c.owned = make(map[goclip.Board]*copied)
+	return nil
+}
@@ -0,0 +1,216 @@
+package memclip
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/KarpelesLab/goclip"
+)
+
+func pasteText(t *testing.T, c *goclip.Clipboard, board goclip.Board) string {
+	t.Helper()
+	data, err := c.PasteFrom(context.Background(), board)
+	if err != nil {
+		t.Fatalf("paste from %s: %s", board, err)
+	}
+	text, err := data.ToText(context.Background())
+	if err != nil {
+		t.Fatalf("paste from %s: %s", board, err)
+	}
+	return text
+}
+
+func TestCopyPaste(t *testing.T) {
+	ctx := context.Background()
+	c := goclip.NewClipboard(New())
+
+	boards := []goclip.Board{goclip.Default, goclip.PrimarySelection, goclip.SecondarySelection}
+	for _, board := range boards {
+		if _, err := c.PasteFrom(ctx, board); !errors.Is(err, goclip.ErrNoData) {
+			t.Errorf("paste from empty %s: got %v, expected ErrNoData", board, err)
+		}
+		if err := c.CopyTo(ctx, board, "text on "+board.String()); err != nil {
+			t.Fatalf("copy to %s: %s", board, err)
+		}
+	}
+	for _, board := range boards {
+		if text := pasteText(t, c, board); text != "text on "+board.String() {
+			t.Errorf("paste from %s: got %q", board, text)
+		}
+	}
+
+	if err := c.CopyTo(ctx, goclip.InvalidBoard, "text"); !errors.Is(err, goclip.ErrNoBoard) {
+		t.Errorf("copy to invalid board: got %v, expected ErrNoBoard", err)
+	}
+	if _, err := c.FetchFormats(ctx, goclip.Default, "image/png"); err != nil {
+		t.Errorf("fetch unavailable format: %s", err)
+	}
+}
+
+func TestTake(t *testing.T) {
+	ctx := context.Background()
+	clip := New()
+	c := goclip.NewClipboard(clip)
+
+	mon, err := c.NewMonitor()
+	if err != nil {
+		t.Fatalf("new monitor: %s", err)
+	}
+	var events []string
+	mon.Subscribe(func(d goclip.Data) error {
+		text, _ := d.ToText(ctx)
+		events = append(events, text)
+		return nil
+	})
+
+	lost := make(chan struct{})
+	if err := c.Copy(ctx, "ours", goclip.OnLost(func() { close(lost) })); err != nil {
+		t.Fatalf("copy: %s", err)
+	}
+	if !c.IsOwner(goclip.Default) {
+		t.Errorf("not owner after copy")
+	}
+
+	if err := clip.Take(goclip.Default, goclip.SpawnText("theirs")); err != nil {
+		t.Fatalf("take: %s", err)
+	}
+	select {
+	case <-lost:
+	default:
+		t.Errorf("OnLost not called after take")
+	}
+	if c.IsOwner(goclip.Default) {
+		t.Errorf("still owner after take")
+	}
+	if text := pasteText(t, c, goclip.Default); text != "theirs" {
+		t.Errorf("paste after take: got %q", text)
+	}
+	if len(events) != 2 || events[0] != "ours" || events[1] != "theirs" {
+		t.Errorf("monitor events: got %q", events)
+	}
+}
+
+func TestMaxServes(t *testing.T) {
+	ctx := context.Background()
+	c := goclip.NewClipboard(New())
+
+	if err := c.Copy(ctx, "secret", goclip.MaxServes(2)); err != nil {
+		t.Fatalf("copy: %s", err)
+	}
+	for n := 0; n < 2; n++ {
+		if text := pasteText(t, c, goclip.Default); text != "secret" {
+			t.Errorf("paste #%d: got %q", n+1, text)
+		}
+	}
+	if _, err := c.Paste(ctx); !errors.Is(err, goclip.ErrNoData) {
+		t.Errorf("paste after max serves: got %v, expected ErrNoData", err)
+	}
+}
+
+func TestWait(t *testing.T) {
+	ctx := context.Background()
+	c := goclip.NewClipboard(New())
+
+	res := make(chan error)
+	go func() {
+		res <- c.Copy(ctx, "once", goclip.MaxServes(1), goclip.Wait())
+	}()
+
+	// wait for the copy to be done before pasting
+	for !c.IsOwner(goclip.Default) {
+		time.Sleep(time.Millisecond)
+	}
+	if text := pasteText(t, c, goclip.Default); text != "once" {
+		t.Errorf("paste: got %q", text)
+	}
+	select {
+	case err := <-res:
+		if err != nil {
+			t.Errorf("copy: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("copy did not return after paste")
+	}
+}
+
+func TestCopyQueue(t *testing.T) {
+	ctx := context.Background()
+	c := goclip.NewClipboard(New())
+
+	lost := make(chan struct{})
+	if err := c.CopyQueue(ctx, goclip.Default, "first", "second", "third", goclip.OnLost(func() { close(lost) })); err != nil {
+		t.Fatalf("copy queue: %s", err)
+	}
+	for _, expected := range []string{"first", "second", "third"} {
+		if text := pasteText(t, c, goclip.Default); text != expected {
+			t.Errorf("paste: got %q, expected %q", text, expected)
+		}
+	}
+	if _, err := c.Paste(ctx); !errors.Is(err, goclip.ErrNoData) {
+		t.Errorf("paste after queue: got %v, expected ErrNoData", err)
+	}
+	select {
+	case <-lost:
+	default:
+		t.Errorf("OnLost not called after queue was served")
+	}
+
+	if err := c.CopyQueue(ctx, goclip.Default); !errors.Is(err, goclip.ErrNoData) {
+		t.Errorf("empty queue: got %v, expected ErrNoData", err)
+	}
+}
+
+func TestExpireAfter(t *testing.T) {
+	ctx := context.Background()
+	c := goclip.NewClipboard(New())
+
+	lost := make(chan struct{})
+	if err := c.Copy(ctx, "secret", goclip.ExpireAfter(10*time.Millisecond), goclip.OnLost(func() { close(lost) })); err != nil {
+		t.Fatalf("copy: %s", err)
+	}
+	if text := pasteText(t, c, goclip.Default); text != "secret" {
+		t.Errorf("paste before expiry: got %q", text)
+	}
+
+	select {
+	case <-lost:
+	case <-time.After(time.Second):
+		t.Fatalf("OnLost not called after expiry")
+	}
+	if _, err := c.Paste(ctx); !errors.Is(err, goclip.ErrNoData) {
+		t.Errorf("paste after expiry: got %v, expected ErrNoData", err)
+	}
+	if c.IsOwner(goclip.Default) {
+		t.Errorf("still owner after expiry")
+	}
+}
+
+func TestOnRequest(t *testing.T) {
+	ctx := context.Background()
+	clip := New()
+	c := goclip.NewClipboard(clip)
+
+	var formats []string
+	err := c.Copy(ctx, "secret", goclip.OnRequest(func(req *goclip.Request) goclip.Data {
+		formats = append(formats, req.Format)
+		if req.Format == "text/plain" {
+			return nil
+		}
+		return req.Data
+	}))
+	if err != nil {
+		t.Fatalf("copy: %s", err)
+	}
+
+	if text := pasteText(t, c, goclip.Default); text != "secret" {
+		t.Errorf("paste: got %q", text)
+	}
+	if _, err := clip.Fetch(ctx, goclip.Default, "text/plain"); !errors.Is(err, goclip.ErrNoData) {
+		t.Errorf("denied fetch: got %v, expected ErrNoData", err)
+	}
+	if len(formats) != 2 || formats[0] != "" || formats[1] != "text/plain" {
+		t.Errorf("requested formats: got %q", formats)
+	}
+}
@@ -9,23 +9,25 @@ type MonitorCallback func(Data) error
 // Monitor returns a new clipboard monitor that can capture events from the
 // clipboard based on various rules.
 type Monitor struct {
+	b  Backend
 	cb []MonitorCallback
 }
 
 func NewMonitor() (*Monitor, error) {
-	mon := &Monitor{}
-	err := i.monitor(mon)
+	c, err := getDefault()
 	if err != nil {
 		return nil, err
 	}
-	return mon, nil
+	return c.NewMonitor()
 }
 
 func (m *Monitor) Subscribe(cb MonitorCallback) {
 	m.cb = append(m.cb, cb)
 }
 
-func (m *Monitor) fire(ev Data) error {
+// Fire calls all the callbacks subscribed to the monitor with the given
+// event. It is meant to be called by backends when the clipboard changes.
+func (m *Monitor) Fire(ev Data) error {
 	// call all callbacks
 	for _, cb := range m.cb {
 		err := cb(ev)
@@ -39,9 +41,9 @@ func (m *Monitor) fire(ev Data) error {
 // Poll should be called when the app regains focus for example, and will check
 // if any change happened to the clipboard.
 func (m *Monitor) Poll() error {
-	return i.poll(m)
+	return m.b.Poll(m)
 }
 
 func (m *Monitor) Close() error {
-	return i.unmonitor(m)
+	return m.b.Unmonitor(m)
 }
@@ -0,0 +1,152 @@
+package goclip
+
+/*
+#include <stdlib.h>
+#include <xcb/xcb.h>
+*/
+import "C"
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// reconnectMinDelay and reconnectMaxDelay bound the delay between
+	// attempts to reconnect to the X server, which doubles after each failure
+	reconnectMinDelay = 100 * time.Millisecond
+	reconnectMaxDelay = 30 * time.Second
+	// reownTimeout is the maximum time taken to own again our boards after
+	// reconnecting
+	reownTimeout = 5 * time.Second
+)
+
+// lostCh returns a channel closed when the current connection to the X server
+// is lost
+func (i *internal) lostCh() chan struct{} {
+	i.connL.RLock()
+	defer i.connL.RUnlock()
+
+	return i.lost
+}
+
+// isDisconnected returns true if the connection to the X server was lost and
+// not established again yet
+func (i *internal) isDisconnected() bool {
+	lost := i.lostCh()
+	if lost == nil {
+		// never connected
+		return false
+	}
+	select {
+	case <-lost:
+		return true
+	default:
+		return false
+	}
+}
+
+// disconnected is called by the event loop when the connection to the X
+// server is lost. Pending operations fail with ErrDisconnected, and the state
+// tied to the connection is dropped.
+func (i *internal) disconnected() {
+	i.connL.Lock()
+	close(i.lost)
+	i.connL.Unlock()
+
+	// atoms are only valid for the server that created them
+	i.atomsLk.Lock()
+	i.atoms = make(map[string]C.xcb_atom_t)
+	i.atomsLk.Unlock()
+
+	// requests cancelled in the meantime may be waiting for their answer
+	i.pendingL.Lock()
+	for _, req := range i.pending {
+		req.ch <- evData{selection: req.selection, target: req.target, err: ErrDisconnected}
+	}
+	i.pending = make(map[uint64]*pendingRequest)
+	i.freeProps = nil
+	i.propSeq = 0
+	i.pendingL.Unlock()
+
+	i.abortAllIncr()
+
+	// goroutines using the connection notice it was lost through lostCh, and
+	// release it
+	i.useL.Lock()
+	C.xcb_disconnect(i.dpy)
+	i.dpy = nil
+	i.useL.Unlock()
+}
+
+// reconnect tries to connect again to the X server until it succeeds, waiting
+// longer after each failure. It returns false if the clipboard was closed in
+// the meantime.
+func (i *internal) reconnect() bool {
+	delay := reconnectMinDelay
+	for {
+		select {
+		case <-i.done:
+			return false
+		case <-time.After(delay):
+		}
+
+		if err := i.connect(); err == nil {
+			logger().Info("reconnected to X11", "display", i.display)
+			return true
+		}
+		delay *= 2
+		if delay > reconnectMaxDelay {
+			delay = reconnectMaxDelay
+		}
+	}
+}
+
+// reown takes ownership again of the boards we owned before the connection
+// to the X server was lost
+func (i *internal) reown() {
+	release, err := i.use()
+	if err != nil {
+		// lost again, or closed
+		return
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), reownTimeout)
+	defer cancel()
+
+	i.copyValL.RLock()
+	owned := make(map[Board]*ownedBoard, len(i.copyVal))
+	for board, own := range i.copyVal {
+		owned[board] = own
+	}
+	i.copyValL.RUnlock()
+
+	for board, own := range owned {
+		atom, ok := i.atomCk(linuxBoardName(board))
+		if !ok {
+			continue
+		}
+		t, err := i.serverTime(ctx)
+		if err != nil {
+			logger().Warn("failed to own selection again", "board", board.String(), "error", err)
+			return
+		}
+
+		i.copyValL.Lock()
+		if i.copyVal[board] != own {
+			// replaced in the meantime
+			i.copyValL.Unlock()
+			continue
+		}
+		own.time = t
+		i.copyValL.Unlock()
+
+		C.xcb_set_selection_owner(i.dpy, i.win, atom, t)
+		C.xcb_flush(i.dpy)
+		if i.selectionOwner(atom) != i.win {
+			// another client owns it now
+			i.lose(board, t)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package goclip
 
-import "fmt"
+import (
+	"fmt"
+	"image"
+	"os"
+)
 
 // some useful methods
 
@@ -27,11 +31,30 @@ func spawnValue(values ...interface{}) (Data, error) {
 
 	res := &StaticData{}
 
+	// files are merged into a single list, inserted where the first file was
+	var files []string
+	filesPos := -1
+	fileOp := FileCopy
+
 	for _, vi := range values {
 		// let's try to guess
 		switch v := vi.(type) {
 		case string:
 			res.Options = append(res.Options, &StaticDataOption{StaticType: "text/plain;charset=utf-8", StaticData: []byte(v)})
+		case image.Image:
+			res.Options = append(res.Options, imageOptions(v)...)
+		case *os.File:
+			if filesPos == -1 {
+				filesPos = len(res.Options)
+			}
+			files = append(files, v.Name())
+		case []string:
+			if filesPos == -1 {
+				filesPos = len(res.Options)
+			}
+			files = append(files, v...)
+		case FileOperation:
+			fileOp = v
 		case Data:
 			opts, err := v.GetAllFormats()
 			if err != nil {
@@ -43,5 +66,9 @@ func spawnValue(values ...interface{}) (Data, error) {
 		}
 	}
 
+	if filesPos != -1 {
+		res.Options = append(res.Options[:filesPos], append(fileListOptions(fileOp, files), res.Options[filesPos:]...)...)
+	}
+
 	return res, nil
 }